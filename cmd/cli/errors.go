@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	commit "git-graph/pkg/commit"
+	"os"
+	"strings"
+)
+
+// Exit codes, see the usage text
+const (
+	exit_failure        = 1
+	exit_usage          = 2
+	exit_not_repository = 3
+	exit_bad_revision   = 4
+	exit_empty_range    = 5
+	exit_git_missing    = 6
+)
+
+// usageError is an invalid option or config value.
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string { return e.err.Error() }
+func (e usageError) Unwrap() error { return e.err }
+
+// repositoryError is a -C directory that cannot be entered, reported like
+// a missing repository.
+type repositoryError struct {
+	err error
+}
+
+func (e repositoryError) Error() string { return e.err.Error() }
+func (e repositoryError) Unwrap() error { return e.err }
+
+// fail prints a message for err on stderr and exits with its exit code.
+func fail(err error) {
+	message, code := describeError(err)
+	fmt.Fprintf(os.Stderr, "git-graph: %s\n", message)
+	os.Exit(code)
+}
+
+func describeError(err error) (string, int) {
+	var git_err *commit.GitError
+	errors.As(err, &git_err)
+	var usage_err usageError
+	var repository_err repositoryError
+
+	switch {
+	case errors.As(err, &usage_err):
+		return err.Error(), exit_usage
+	case errors.As(err, &repository_err):
+		return err.Error(), exit_not_repository
+	case errors.Is(err, commit.ErrGitNotInstalled):
+		return "git is not installed or not in PATH, it is needed for these arguments", exit_git_missing
+	case errors.Is(err, commit.ErrNotRepository):
+		return "not a git repository (or any of the parent directories)", exit_not_repository
+	case errors.Is(err, commit.ErrBadRevision):
+		if git_err != nil {
+			return "bad revision: " + gitMessage(git_err.Stderr), exit_bad_revision
+		}
+		return err.Error(), exit_bad_revision
+	case errors.Is(err, commit.ErrEmptyRange):
+		return "no commits in the given range", exit_empty_range
+	case git_err != nil:
+		return fmt.Sprintf("git %s failed:\n%s", strings.Join(git_err.Args, " "), git_err.Stderr), exit_failure
+	}
+	return err.Error(), exit_failure
+}
+
+// gitMessage is the first line git printed without its "fatal: " prefix.
+func gitMessage(stderr string) string {
+	line, _, _ := strings.Cut(stderr, "\n")
+	return strings.TrimPrefix(line, "fatal: ")
+}
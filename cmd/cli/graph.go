@@ -3,49 +3,144 @@ package main
 import (
 	"flag"
 	"fmt"
+	cache "git-graph/pkg/cache"
+	color "git-graph/pkg/color"
 	commit "git-graph/pkg/commit"
+	config "git-graph/pkg/config"
 	graph "git-graph/pkg/graph"
+	logger "git-graph/pkg/logger"
+	theme "git-graph/pkg/theme"
 	"git-graph/pkg/ui"
-	"log"
-	"regexp"
-	"strings"
+	utils "git-graph/pkg/utils"
+	"os"
+	"path/filepath"
+
+	"github.com/mattn/go-isatty"
 )
 
-func prepareLines(input string) []map[string]string {
-	var result []map[string]string
+var from_json = flag.String("from-json", "", "Read commits from a JSON file instead of the repository")
+var no_pager = flag.Bool("no-pager", false, "Print the graph to stdout instead of starting the interactive view")
+var print_graph = flag.Bool("print", false, "Same as --no-pager")
+var repo_dir = flag.String("C", "", "Run as if git-graph was started in this directory")
+var git_dir = flag.String("git-dir", "", "Path of the repository, a .git directory or a bare repository")
+var first_parent = flag.Bool("first-parent", false, "Show only the first-parent chains, merges are collapsed")
+var compact = flag.Bool("compact", false, "Fold long runs of commits without branches, merges or refs into one node")
+var no_cache = flag.Bool("no-cache", false, "Neither read nor write the layout cache in .git/git-graph")
+
+var _ = flag.String("color", "auto", "When to use colors: auto, always or never")
+var _ = flag.String("color-depth", "", "Force the color depth: 16, 256 or truecolor")
+var _ = flag.String("theme", "dark", "Color theme: dark, light, a theme name from ~/.config/git-graph/themes or a path to a theme file")
+var _ = flag.String("glyphs", "rounded", "Glyph set used to draw the graph: rounded, heavy or ascii")
+var _ = flag.String("date", "default", "Date format: default, relative, iso, iso-strict, rfc, short, unix, raw, human or format:<strftime>")
+var _ = flag.String("timezone", "local", "Timezone of dates: local, utc or original")
+var _ = flag.String("order", "default", "Order of the commits: default, topo, date, author-date or lane-stable")
+var _ = flag.Int("max-lanes", 0, "Lanes drawn at most, the others are folded into one overflow lane")
+var _ = flag.Bool("topo-order", false, "Same as --order=topo")
+var _ = flag.Bool("date-order", false, "Same as --order=date")
+var _ = flag.Bool("author-date-order", false, "Same as --order=author-date")
+var _ = flag.String("format", "default", "Format of the commit text: default, oneline, short, full or a format string like \"%h %s %an %ar%d\"")
 
-	pattern := regexp.MustCompile(`(.+) ([a-f0-9]{8}) (.+)`)
-	lines := strings.Split(input, "\n")
+// Flags overriding config file options, by option path. They are only
+// applied when given, so their defaults above are just for the help text.
+var config_flags = map[string]string{
+	"color":       "render.color",
+	"color-depth": "render.color_depth",
+	"theme":       "render.theme",
+	"glyphs":      "render.glyphs",
+	"format":      "render.format",
+	"date":        "render.date",
+	"timezone":    "render.timezone",
+	"order":       "layout.order",
+	"max-lanes":   "layout.max_lanes",
+}
+
+// Orders spelled like the git log options, --order wins over them
+var order_flags = map[string]string{
+	"topo-order":        "topo",
+	"date-order":        "date",
+	"author-date-order": "author-date",
+}
 
-	for _, line := range lines {
-		matches := pattern.FindStringSubmatch(line)
-		if len(matches) == 4 {
-			result = append(result, map[string]string{
-				"hash":  matches[2],
-				"body":  matches[3],
-				"graph": matches[1],
-			})
-		} else if len(matches) == 0 {
-			result = append(result, map[string]string{
-				"graph": line,
-			})
+// loadConfig reads the config files and environment, then applies the flags
+// given on the command line on top.
+func loadConfig() (config.Config, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return cfg, err
+	}
+	flag.Visit(func(f *flag.Flag) {
+		if order, exists := order_flags[f.Name]; exists && err == nil && f.Value.String() == "true" {
+			err = cfg.Set("layout.order", order)
+		}
+	})
+	flag.Visit(func(f *flag.Flag) {
+		if path, exists := config_flags[f.Name]; exists && err == nil {
+			err = cfg.Set(path, f.Value.String())
 		}
+	})
+	if *no_pager || *print_graph {
+		cfg.TUI.Pager = false
+	}
+	if err != nil {
+		return cfg, err
 	}
-	return result
+	return cfg, cfg.Validate()
 }
 
-func argParse() []string {
-	flag.Usage = func() {
-		fmt.Println(`Usage: git-graph [options]
+const usage = `Usage: git-graph [options]
 
 Options:
-	--all		Show all commits. Default option.
-	--help		Show this help message
+	--all			Show all commits. Default option.
+	-C <path>		Run as if git-graph was started in <path>, like git -C
+	--git-dir <path>	Path of the repository: a .git directory, the git directory of a linked
+				worktree or submodule, or a bare repository. Same as GIT_DIR
+	--from-json <file>	Read commits from a JSON file instead of the repository
+	--glyphs <set>		Glyph set used to draw the graph: rounded, heavy or ascii
+	--no-pager, --print	Print the graph to stdout instead of starting the interactive view.
+				Used automatically when stdout is not a terminal
+	--first-parent		Show only the first-parent chains, like git log --first-parent. Each merge
+				stands for the commits it brought in, enter expands it in the interactive view
+	--compact		Fold runs of 3 or more commits without forks, merges or refs into one "N commits"
+				node, enter expands it in the interactive view
+	--order <order>		Order of the commits: default (generation numbers), topo, date and author-date
+				like the git log options, or lane-stable to keep the commits of each branch together.
+				--topo-order, --date-order and --author-date-order are the same as git
+	--max-lanes <n>		Draw at most n lanes, the least used lanes are folded into one
+				overflow lane drawn with ┆ (: with ASCII glyphs)
+	--no-cache		Neither read nor write the layout cache in .git/git-graph
+	--color <when>		When to use colors: auto (default), always or never.
+				In auto mode colors are disabled when stdout is not a terminal or NO_COLOR is set
+	--color-depth <depth>	Force the color depth instead of detecting it: 16, 256 or truecolor
+	--theme <name|path>	Color theme: dark (default), light, a theme from ~/.config/git-graph/themes
+				or a path to a theme file
+	--format <format>	Text shown next to each commit: default, oneline, short, full or a format
+				string using git log --pretty=format placeholders, e.g. "%h %<(30,trunc)%s %an %ar%d"
+	--date <format>		Format of %ad and %cd like git log --date: default, relative, iso, iso-strict,
+				rfc, short, unix, raw, human or format:<strftime>, e.g. format:%d.%m.%Y
+	--timezone <zone>	Show dates in the local timezone (default), utc or the original commit offset
+	--help			Show this help message
+
+Exit codes:
+	1	Any other error
+	2	Invalid option or config value
+	3	Not in a git repository
+	4	Bad revision in the arguments
+	5	No commits in the given range
+	6	git is not installed but needed for the arguments
+
+Defaults for these options are read from ~/.config/git-graph/config.toml,
+.git-graph.toml at the top of the repository and git config graph.* keys.
 
 Examples:
 	git-graph
 	git-graph 0ef00000..HEAD
-	git-graph --help`)
+	git-graph -C ~/src/project
+	git-graph --git-dir ~/repos/project.git
+	git-graph --help`
+
+func argParse() []string {
+	flag.Usage = func() {
+		fmt.Printf("%s\n", usage)
 		flag.PrintDefaults()
 	}
 	flag.Parse()
@@ -55,14 +150,199 @@ Examples:
 	return flag.Args()
 }
 
+// changeRepository applies -C and --git-dir before anything looks for the
+// repository. Both are process wide, like in git, so the config, the native
+// reader and every git command started later use them.
+func changeRepository() error {
+	if *repo_dir != "" {
+		if err := os.Chdir(*repo_dir); err != nil {
+			return repositoryError{fmt.Errorf("cannot change to %s: %w", *repo_dir, err)}
+		}
+	}
+	if *git_dir != "" {
+		path, err := filepath.Abs(*git_dir)
+		if err != nil {
+			return usageError{err}
+		}
+		return os.Setenv("GIT_DIR", path)
+	}
+	return nil
+}
+
 func main() {
 	args := argParse()
+	if err := changeRepository(); err != nil {
+		fail(err)
+	}
+	if *first_parent && *compact {
+		fail(usageError{fmt.Errorf("--first-parent and --compact cannot be combined")})
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fail(usageError{err})
+	}
+	logger.Configure(cfg.Log.Level, cfg.Log.Dir)
+	utils.SetSaveCommits(cfg.Log.SaveJSON)
+
+	glyphs, err := graph.GlyphSetByName(cfg.Render.Glyphs)
+	if err != nil {
+		fail(usageError{err})
+	}
+	order, err := graph.OrderByName(cfg.Layout.Order)
+	if err != nil {
+		fail(usageError{err})
+	}
+	graph.SetOrder(order)
+	graph.SetReduceCrossings(cfg.Layout.ReduceCrossings)
+	is_terminal := isatty.IsTerminal(os.Stdout.Fd()) || isatty.IsCygwinTerminal(os.Stdout.Fd())
+	interactive := is_terminal && cfg.TUI.Pager
+
+	mode, err := color.ParseMode(cfg.Render.Color)
+	if err != nil {
+		fail(usageError{err})
+	}
+	profile := color.ResolveProfile(mode, is_terminal)
+	if cfg.Render.ColorDepth != "" && profile != color.NoColor {
+		if profile, err = color.ParseProfile(cfg.Render.ColorDepth); err != nil {
+			fail(usageError{err})
+		}
+	}
+	graph_theme, err := theme.Load(cfg.Render.Theme)
+	if err != nil {
+		fail(usageError{err})
+	}
+	template, err := commit.ParseTemplate(cfg.Render.Format)
+	if err != nil {
+		fail(usageError{err})
+	}
+	if template.Dates, err = commit.ParseDateFormat(cfg.Render.Date, cfg.Render.Timezone); err != nil {
+		fail(usageError{err})
+	}
+	options := graph.RenderOptions{
+		Glyphs:   glyphs,
+		Color:    profile,
+		Theme:    graph_theme,
+		XSpacing: cfg.Layout.XSpacing,
+		YSpacing: cfg.Layout.YSpacing,
+		Template: template,
+		MaxLanes: cfg.Layout.MaxLanes,
+	}
 
-	commits, err := commit.ParseCommits(args)
+	source, err := commit.SourceForBackend(cfg.Git.Backend, args)
 	if err != nil {
-		log.Fatal(err)
+		fail(usageError{err})
+	}
+	var layout_cache *cache.Cache
+	if *from_json != "" {
+		source = commit.JSONSource{Path: *from_json}
+	} else if cfg.Git.Cache && !*no_cache && !*first_parent && !*compact {
+		// Without a readable repository the commits are read as usual
+		if layout_cache, err = cache.Open(args, cfg.Layout.Order, cfg.Layout.ReduceCrossings); err != nil {
+			logger.GetDefaultLogger().Debug(fmt.Sprintf("layout cache disabled: %v", err))
+		}
+	}
+
+	if interactive {
+		ui.SetColorProfile(profile)
+		ui.SetTheme(graph_theme)
+		ui.SetShowDetails(cfg.TUI.ShowDetails)
+		ui.SetDateFormat(template.Dates)
+	}
+
+	if *first_parent || *compact {
+		// Every commit is read, expanding a node shows the ones it stands for
+		commits, err := source.Commits()
+		if err != nil {
+			fail(err)
+		}
+		if len(commits) == 0 {
+			fail(commit.ErrEmptyRange)
+		}
+		var view ui.Expandable = graph.NewChainView(commits, options)
+		if *first_parent {
+			view = graph.NewFirstParentView(commits, options)
+		}
+		if interactive {
+			err = ui.RunExpandable(view, cfg.Layout.YSpacing)
+		} else {
+			for _, line := range view.Lines() {
+				fmt.Println(line.String())
+			}
+		}
+		if err != nil {
+			fail(err)
+		}
+		return
 	}
 
-	graph_str := graph.ProcessCommits(&commits)
-	ui.Run(prepareLines(graph_str), graph.Y_SPACING)
+	if !interactive {
+		// Rows can still move until the last commit is read, nothing is
+		// printed before the whole layout
+		layout, err := loadLayout(source, layout_cache, cfg.Git.Backend)
+		if err != nil {
+			fail(err)
+		}
+		if len(layout.Commits) == 0 {
+			fail(commit.ErrEmptyRange)
+		}
+		for _, line := range graph.DrawGraphLines(layout.Commits, layout.MaxX, layout.MaxY, options) {
+			fmt.Println(line.String())
+		}
+		return
+	}
+
+	var lazy *graph.LazyGraph
+	if layout_cache != nil && (layout_cache.Cached() || layout_cache.CanExtend()) {
+		layout, err := loadLayout(source, layout_cache, cfg.Git.Backend)
+		if err != nil {
+			fail(err)
+		}
+		lazy = graph.NewCompleteGraph(layout, options)
+	} else {
+		// The view starts with the first commits while the rest are still read
+		lazy = graph.NewLazyGraph(options)
+		lazy.Load(source)
+		if layout_cache != nil {
+			go storeLayout(lazy, layout_cache)
+		}
+	}
+	if err := ui.Run(lazy, cfg.Layout.YSpacing); err != nil {
+		fail(err)
+	}
+}
+
+// loadLayout reads the layout from the cache when the refs did not change,
+// otherwise lays out the commits and updates the cache.
+func loadLayout(source commit.CommitSource, layout_cache *cache.Cache, backend string) (graph.Layout, error) {
+	if layout_cache == nil {
+		commits, err := source.Commits()
+		if err != nil {
+			return graph.Layout{}, err
+		}
+		return graph.ComputeLayout(&commits), nil
+	}
+	if layout, exists := layout_cache.Load(); exists {
+		return layout, nil
+	}
+	commits, err := layout_cache.Commits(backend)
+	if err != nil {
+		return graph.Layout{}, err
+	}
+	layout, err := layout_cache.Store(commits)
+	if err != nil {
+		logger.GetDefaultLogger().Debug(err.Error())
+	}
+	return layout, nil
+}
+
+// storeLayout caches the layout of a streamed history once it is read.
+func storeLayout(lazy *graph.LazyGraph, layout_cache *cache.Cache) {
+	commits, err := lazy.Commits()
+	if err != nil {
+		return
+	}
+	if _, err := layout_cache.Store(commits); err != nil {
+		logger.GetDefaultLogger().Debug(err.Error())
+	}
 }
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The test binary runs main instead of the tests when this is set, so the
+// tests can start git-graph with its stdout going to a pipe.
+const run_main_env = "GIT_GRAPH_TEST_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(run_main_env) == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runGitGraph runs git-graph with args in an empty directory, without the
+// user config, and returns its stdout and exit code.
+func runGitGraph(t *testing.T, args ...string) (string, int) {
+	t.Helper()
+	home := t.TempDir()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = t.TempDir()
+	cmd.Env = append(os.Environ(),
+		run_main_env+"=1",
+		"HOME="+home, "XDG_CONFIG_HOME="+filepath.Join(home, ".config"),
+		"GIT_CONFIG_NOSYSTEM=1", "GIT_CONFIG_GLOBAL="+os.DevNull,
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	var exit_err *exec.ExitError
+	if err != nil && !errors.As(err, &exit_err) {
+		t.Fatal(err)
+	}
+	t.Logf("stderr: %s", stderr.String())
+	return stdout.String(), cmd.ProcessState.ExitCode()
+}
+
+// Without a terminal the graph is printed as plain text
+func TestPrintToPipe(t *testing.T) {
+	fixture, err := filepath.Abs(filepath.Join("..", "..", "pkg", "graph", "testdata", "fixtures", "many-merges-readable.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, code := runGitGraph(t, "--from-json", fixture)
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+	if !strings.Contains(output, "M b1<-b2") || !strings.Contains(output, "●") {
+		t.Errorf("expected the graph on stdout, got\n%s", output)
+	}
+	if strings.Contains(output, "\x1b[") {
+		t.Errorf("expected no ANSI codes, got\n%q", output)
+	}
+
+	output, _ = runGitGraph(t, "--from-json", fixture, "--color", "always")
+	if !strings.Contains(output, "\x1b[") {
+		t.Errorf("expected ANSI codes with --color always, got\n%q", output)
+	}
+}
+
+func TestRepositoryOptions(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	if _, code := runGitGraph(t, "-C", filepath.Join(t.TempDir(), "missing")); code != exit_not_repository {
+		t.Errorf("expected exit code %d for a missing -C directory, got %d", exit_not_repository, code)
+	}
+	if _, code := runGitGraph(t, "-C", t.TempDir()); code != exit_not_repository {
+		t.Errorf("expected exit code %d outside a repository, got %d", exit_not_repository, code)
+	}
+
+	// A non-bare repository whose git directory is not named .git keeps its
+	// worktree, shown from a linked worktree
+	dir := t.TempDir()
+	git := exec.Command("sh", "-c", `git init -q -b main repo &&
+		git -C repo -c user.name=test -c user.email=test@example.com commit -q --allow-empty -m first &&
+		mv repo/.git store &&
+		git --git-dir store worktree add -q linked -b topic`)
+	git.Dir = dir
+	git.Env = append(os.Environ(), "GIT_CONFIG_NOSYSTEM=1", "GIT_CONFIG_GLOBAL="+os.DevNull)
+	if output, err := git.CombinedOutput(); err != nil {
+		t.Fatalf("%v\n%s", err, output)
+	}
+	for _, backend := range []string{"native", "exec"} {
+		t.Setenv("GRAPH_GIT_BACKEND", backend)
+		output, code := runGitGraph(t, "-C", filepath.Join(dir, "linked"), "--format", "%s%d")
+		if code != 0 {
+			t.Fatalf("%s: expected exit code 0, got %d", backend, code)
+		}
+		if !strings.Contains(output, "first (HEAD -> topic, worktree: store -> main)") {
+			t.Errorf("%s: expected the main worktree on the first commit, got\n%s", backend, output)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package cache
+
+import (
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	commit_pkg "git-graph/pkg/commit"
+	graph_pkg "git-graph/pkg/graph"
+	logger_pkg "git-graph/pkg/logger"
+	repo_pkg "git-graph/pkg/repo"
+)
+
+type Commit = commit_pkg.Commit
+
+// Bumped whenever the layout or the file format changes, older files are
+// then ignored
+const cache_version = 8
+
+const cache_dir_name = "git-graph"
+
+var logger = logger_pkg.GetDefaultLogger()
+
+// State is what a layout depends on besides the commits: the arguments, the
+// order of the rows, whether crossings are reduced, HEAD, every ref and what
+// the other worktrees have checked out.
+type State struct {
+	Args            []string
+	Order           string
+	ReduceCrossings bool
+	HeadTarget      string
+	HeadHash        string
+	Refs            []repo_pkg.Reference
+	Worktrees       []repo_pkg.Worktree
+}
+
+func (s State) equal(other State) bool {
+	return slices.Equal(s.Args, other.Args) &&
+		s.Order == other.Order &&
+		s.ReduceCrossings == other.ReduceCrossings &&
+		s.HeadTarget == other.HeadTarget &&
+		s.HeadHash == other.HeadHash &&
+		slices.Equal(s.Refs, other.Refs) &&
+		slices.Equal(s.Worktrees, other.Worktrees)
+}
+
+// tips returns the commits HEAD, the refs and the worktrees point to, without
+// duplicates.
+func (s State) tips() []string {
+	tips := make([]string, 0, len(s.Refs)+len(s.Worktrees)+1)
+	if s.HeadHash != "" {
+		tips = append(tips, s.HeadHash)
+	}
+	for _, ref := range s.Refs {
+		tips = append(tips, ref.Commit())
+	}
+	for _, worktree := range s.Worktrees {
+		if worktree.Hash != "" {
+			tips = append(tips, worktree.Hash)
+		}
+	}
+	slices.Sort(tips)
+	return slices.Compact(tips)
+}
+
+type entry struct {
+	Version int
+	State   State
+	MaxX    int
+	MaxY    int
+	// Laid out commits, dummy commits included
+	Commits []Commit
+}
+
+// Cache is the stored layout of one list of arguments in a repository. It is
+// kept in .git/git-graph/ so that a later run with the same refs skips
+// reading and laying out the commits.
+type Cache struct {
+	path   string
+	state  State
+	stored *entry
+}
+
+// Open reads the refs of the repository in the current directory and the
+// layout stored for args laid out in order, if any.
+func Open(args []string, order string, reduce_crossings bool) (*Cache, error) {
+	repo, err := repo_pkg.Discover(".")
+	if err != nil {
+		return nil, err
+	}
+	defer repo.Close()
+
+	refs, err := repo.References()
+	if err != nil {
+		return nil, err
+	}
+	head_target, head_hash, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	worktrees, err := repo.Worktrees()
+	if err != nil {
+		return nil, err
+	}
+
+	key := sha1.Sum([]byte(strings.Join(append([]string{order, strconv.FormatBool(reduce_crossings)}, args...), "\x00")))
+	c := &Cache{
+		path:  filepath.Join(repo.GitDir, cache_dir_name, "layout-"+hex.EncodeToString(key[:8])+".gob"),
+		state: State{Args: args, Order: order, ReduceCrossings: reduce_crossings, HeadTarget: head_target, HeadHash: head_hash, Refs: refs, Worktrees: worktrees},
+	}
+	c.stored = c.read()
+	return c, nil
+}
+
+func (c *Cache) read() *entry {
+	file, err := os.Open(c.path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	stored := &entry{}
+	if err := gob.NewDecoder(file).Decode(stored); err != nil {
+		logger.Debug(fmt.Sprintf("ignoring unreadable cache %s: %v", c.path, err))
+		return nil
+	}
+	if stored.Version != cache_version || !slices.Equal(stored.State.Args, c.state.Args) || stored.State.Order != c.state.Order || stored.State.ReduceCrossings != c.state.ReduceCrossings {
+		return nil
+	}
+	return stored
+}
+
+// Load returns the stored layout when HEAD and the refs are the same as when
+// it was stored.
+func (c *Cache) Load() (graph_pkg.Layout, bool) {
+	if !c.Cached() {
+		return graph_pkg.Layout{}, false
+	}
+	commits_map := make(graph_pkg.CommitsMap, len(c.stored.Commits))
+	for i := range c.stored.Commits {
+		commits_map[c.stored.Commits[i].Hash] = &c.stored.Commits[i]
+	}
+	logger.Debug(fmt.Sprintf("layout of %d commits read from %s", len(commits_map), c.path))
+	return graph_pkg.Layout{Commits: commits_map, MaxX: c.stored.MaxX, MaxY: c.stored.MaxY}, true
+}
+
+// Cached reports whether Load returns a layout.
+func (c *Cache) Cached() bool {
+	return c.stored != nil && c.stored.State.equal(c.state)
+}
+
+// CanExtend reports whether Commits only reads the commits added since the
+// layout was stored. That is the case for --all, the stored commits are then
+// everything reachable from the refs of that time.
+func (c *Cache) CanExtend() bool {
+	return c.stored != nil && slices.Equal(c.state.Args, []string{"--all"})
+}
+
+// Commits reads the commits to lay out with backend. When the stored layout
+// can be extended, only the commits it does not have are read, the stored
+// ones no longer reachable from a ref are dropped and every commit gets the
+// current refs.
+func (c *Cache) Commits(backend string) (map[string]Commit, error) {
+	if !c.CanExtend() {
+		source, err := commit_pkg.SourceForBackend(backend, c.state.Args)
+		if err != nil {
+			return nil, err
+		}
+		return source.Commits()
+	}
+	commits := storedCommits(c.stored.Commits)
+	tips := c.state.tips()
+	added, err := c.readAdded(backend, tips, commits)
+	if err != nil {
+		return nil, err
+	}
+	for hash, added_commit := range added {
+		commits[hash] = added_commit
+	}
+	commits = reachable(commits, tips)
+	decorate(commits, c.state)
+	logger.Debug(fmt.Sprintf("cached layout extended with %d commits", len(added)))
+	return commits, nil
+}
+
+// readAdded walks from the tips down to the stored commits, `git log` is
+// given the stored tips as excluded revisions instead.
+func (c *Cache) readAdded(backend string, tips []string, stored map[string]Commit) (map[string]Commit, error) {
+	if backend != "exec" {
+		known := make(map[string]bool, len(stored))
+		for hash := range stored {
+			known[hash] = true
+		}
+		added, err := commit_pkg.ReadCommitsNative(tips, known)
+		if err == nil || backend == "native" || !errors.Is(err, repo_pkg.ErrUnsupported) {
+			return added, err
+		}
+		logger.Debug(fmt.Sprintf("native reader failed, falling back to git log: %v", err))
+	}
+	if len(tips) == 0 {
+		return map[string]Commit{}, nil
+	}
+	args := slices.Clone(tips)
+	for _, tip := range c.stored.State.tips() {
+		args = append(args, "^"+tip)
+	}
+	return commit_pkg.GitCLISource{Args: args}.Commits()
+}
+
+// Store lays out commits and writes the layout for the next run. The layout
+// is returned even when it cannot be written.
+func (c *Cache) Store(commits map[string]Commit) (graph_pkg.Layout, error) {
+	layout := graph_pkg.ComputeLayout(&commits)
+	stored := &entry{
+		Version: cache_version,
+		State:   c.state,
+		MaxX:    layout.MaxX,
+		MaxY:    layout.MaxY,
+		Commits: make([]Commit, 0, len(layout.Commits)),
+	}
+	for _, laid_out := range graph_pkg.SortCommits(layout.Commits) {
+		stored.Commits = append(stored.Commits, *laid_out)
+	}
+	if err := c.write(stored); err != nil {
+		return layout, fmt.Errorf("cannot write layout cache: %w", err)
+	}
+	c.stored = stored
+	return layout, nil
+}
+
+// write replaces the cache file at once, a run stopped halfway leaves the
+// previous file in place.
+func (c *Cache) write(stored *entry) error {
+	dir := filepath.Dir(c.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(dir, "layout-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if err := gob.NewEncoder(file).Encode(stored); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), c.path)
+}
+
+// storedCommits turns laid out commits back into the commits of a source,
+// dummy commits are dropped and replaced by the parent they lead to.
+func storedCommits(laid_out []Commit) map[string]Commit {
+	dummy_parents := make(map[string]string)
+	for _, c := range laid_out {
+		if strings.HasPrefix(c.Hash, "dummy_") && len(c.Parents) == 1 {
+			dummy_parents[c.Hash] = c.Parents[0]
+		}
+	}
+	commits := make(map[string]Commit, len(laid_out))
+	for _, c := range laid_out {
+		if _, exists := dummy_parents[c.Hash]; exists {
+			continue
+		}
+		parents := make([]string, len(c.Parents))
+		for i, parent_hash := range c.Parents {
+			for {
+				real_parent, exists := dummy_parents[parent_hash]
+				if !exists {
+					break
+				}
+				parent_hash = real_parent
+			}
+			parents[i] = parent_hash
+		}
+		c.Parents = parents
+		c.X_pos = 0
+		commits[c.Hash] = c
+	}
+	return commits
+}
+
+// reachable keeps the commits reachable from tips.
+func reachable(commits map[string]Commit, tips []string) map[string]Commit {
+	result := make(map[string]Commit, len(commits))
+	stack := slices.Clone(tips)
+	for len(stack) > 0 {
+		hash := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if _, done := result[hash]; done {
+			continue
+		}
+		c, exists := commits[hash]
+		if !exists {
+			continue
+		}
+		result[hash] = c
+		stack = append(stack, c.Parents...)
+	}
+	return result
+}
+
+// decorate replaces the refs of every commit with the current ones, grafted
+// markers of shallow clones are kept.
+func decorate(commits map[string]Commit, state State) {
+	decorations := commit_pkg.RefDecorations(state.Refs, state.HeadTarget, state.HeadHash, state.Worktrees)
+	for hash, c := range commits {
+		refs := slices.Clone(decorations[hash])
+		for _, ref := range c.Refs {
+			if ref.Kind == commit_pkg.RefGrafted {
+				refs = append(refs, ref)
+			}
+		}
+		c.Refs = refs
+		commits[hash] = c
+	}
+}
@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	commit_pkg "git-graph/pkg/commit"
+	graph_pkg "git-graph/pkg/graph"
+)
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(cmd.Environ(),
+		"GIT_CONFIG_NOSYSTEM=1", "GIT_CONFIG_GLOBAL=/dev/null",
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, output)
+	}
+	return string(output)
+}
+
+// checkLayout compares a cached layout with the layout of the commits read
+// again from the repository.
+func checkLayout(t *testing.T, layout graph_pkg.Layout, args ...string) {
+	t.Helper()
+	commits, err := commit_pkg.NativeSource{Args: args}.Commits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := graph_pkg.ComputeLayout(&commits)
+	if layout.MaxX != expected.MaxX || layout.MaxY != expected.MaxY {
+		t.Errorf("cached layout is %dx%d instead of %dx%d", layout.MaxX, layout.MaxY, expected.MaxX, expected.MaxY)
+	}
+	if len(layout.Commits) != len(expected.Commits) {
+		t.Errorf("cached layout has %d commits instead of %d", len(layout.Commits), len(expected.Commits))
+	}
+	// Slices read back from the cache are nil when they were empty
+	describe := func(c *Commit) string {
+		return fmt.Sprintf("x=%d y=%d parents=%v refs=%v", c.X_pos, c.Y_pos, c.Parents, c.Refs)
+	}
+	for hash, expected_commit := range expected.Commits {
+		if c, exists := layout.Commits[hash]; !exists {
+			t.Errorf("%s missing from the cached layout", hash)
+		} else if describe(c) != describe(expected_commit) {
+			t.Errorf("%s: cached %s, expected %s", hash, describe(c), describe(expected_commit))
+		}
+	}
+}
+
+func commitCount(t *testing.T, args ...string) int {
+	t.Helper()
+	c, err := Open(args, "default", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commits, err := c.Commits("auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(commits)
+}
+
+func TestCacheExtend(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	runGit(t, dir, "init", "-q", "-b", "main")
+	runGit(t, dir, "commit", "-q", "--allow-empty", "-m", "first")
+	runGit(t, dir, "commit", "-q", "--allow-empty", "-m", "second")
+	runGit(t, dir, "checkout", "-q", "-b", "topic")
+	runGit(t, dir, "commit", "-q", "--allow-empty", "-m", "topic")
+	runGit(t, dir, "checkout", "-q", "main")
+	t.Chdir(dir)
+
+	args := []string{"--all"}
+	c, err := Open(args, "default", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := c.Load(); exists {
+		t.Fatal("nothing should be cached yet")
+	}
+	commits, err := c.Commits("auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := c.Store(commits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, ".git", cache_dir_name, "layout-*.gob")); len(files) != 1 {
+		t.Errorf("expected one cache file, got %v", files)
+	}
+
+	c, err = Open(args, "default", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout, exists := c.Load()
+	if !exists {
+		t.Fatal("the layout should be cached while the refs are unchanged")
+	}
+	if len(layout.Commits) != len(stored.Commits) || layout.MaxX != stored.MaxX || layout.MaxY != stored.MaxY {
+		t.Errorf("cached layout differs from the stored one")
+	}
+	checkLayout(t, layout, args...)
+
+	runGit(t, dir, "commit", "-q", "--allow-empty", "-m", "third")
+	head := runGit(t, dir, "rev-parse", "HEAD")[:40]
+	c, err = Open(args, "default", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := c.Load(); exists {
+		t.Fatal("a new commit should invalidate the cached layout")
+	}
+	if !c.CanExtend() {
+		t.Fatal("the --all layout should be extended")
+	}
+	commits, err = c.Commits("auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 4 {
+		t.Errorf("expected 4 commits, got %d", len(commits))
+	}
+	if len(commits[head].Refs) == 0 {
+		t.Errorf("the new commit should carry the main and HEAD refs")
+	}
+	for hash, extended := range commits {
+		if hash != head && len(extended.Refs) > 0 && extended.Message == "second" {
+			t.Errorf("main moved away from %q but it still has refs %v", extended.Message, extended.Refs)
+		}
+	}
+	if _, err := c.Store(commits); err != nil {
+		t.Fatal(err)
+	}
+	// The extended layout is the one of the whole history
+	c, err = Open(args, "default", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layout, exists = c.Load(); !exists {
+		t.Fatal("the extended layout should be cached")
+	}
+	checkLayout(t, layout, args...)
+
+	runGit(t, dir, "branch", "-q", "-D", "topic")
+	if count := commitCount(t, args...); count != 3 {
+		t.Errorf("commits of a deleted branch should be dropped, got %d commits", count)
+	}
+
+	// Other arguments are read again instead
+	if count := commitCount(t, "main"); count != 3 {
+		t.Errorf("expected 3 commits on main, got %d", count)
+	}
+}
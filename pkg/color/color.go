@@ -0,0 +1,80 @@
+package color
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+type Mode int
+
+const (
+	Auto Mode = iota
+	Always
+	Never
+)
+
+func ParseMode(name string) (Mode, error) {
+	switch name {
+	case "auto", "":
+		return Auto, nil
+	case "always":
+		return Always, nil
+	case "never":
+		return Never, nil
+	}
+	return Auto, fmt.Errorf("unknown color mode %q, expected one of: auto, always, never", name)
+}
+
+// Profile is the color depth escape sequences are generated for.
+type Profile int
+
+const (
+	NoColor Profile = iota
+	ANSI16
+	ANSI256
+	TrueColor
+)
+
+func ParseProfile(name string) (Profile, error) {
+	switch name {
+	case "16":
+		return ANSI16, nil
+	case "256":
+		return ANSI256, nil
+	case "truecolor", "24bit":
+		return TrueColor, nil
+	}
+	return NoColor, fmt.Errorf("unknown color depth %q, expected one of: 16, 256, truecolor", name)
+}
+
+// DetectProfile guesses the color depth of the terminal from COLORTERM and TERM.
+func DetectProfile() Profile {
+	color_term := strings.ToLower(os.Getenv("COLORTERM"))
+	if color_term == "truecolor" || color_term == "24bit" {
+		return TrueColor
+	}
+	term := strings.ToLower(os.Getenv("TERM"))
+	if term == "dumb" {
+		return NoColor
+	}
+	if strings.Contains(term, "256color") {
+		return ANSI256
+	}
+	return ANSI16
+}
+
+// ResolveProfile applies the --color mode. NO_COLOR disables colors in auto
+// mode only, an explicit --color=always still wins over it.
+func ResolveProfile(mode Mode, is_terminal bool) Profile {
+	switch mode {
+	case Never:
+		return NoColor
+	case Always:
+		return max(DetectProfile(), ANSI16)
+	}
+	if !is_terminal || os.Getenv("NO_COLOR") != "" {
+		return NoColor
+	}
+	return DetectProfile()
+}
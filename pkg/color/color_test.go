@@ -0,0 +1,48 @@
+package color
+
+import (
+	"testing"
+)
+
+func TestResolveProfile(t *testing.T) {
+	t.Setenv("COLORTERM", "truecolor")
+	t.Setenv("NO_COLOR", "")
+
+	if profile := ResolveProfile(Auto, false); profile != NoColor {
+		t.Errorf("auto without terminal: expected NoColor, got %v", profile)
+	}
+	if profile := ResolveProfile(Auto, true); profile != TrueColor {
+		t.Errorf("auto on terminal: expected TrueColor, got %v", profile)
+	}
+	if profile := ResolveProfile(Never, true); profile != NoColor {
+		t.Errorf("never: expected NoColor, got %v", profile)
+	}
+
+	t.Setenv("NO_COLOR", "1")
+	if profile := ResolveProfile(Auto, true); profile != NoColor {
+		t.Errorf("auto with NO_COLOR: expected NoColor, got %v", profile)
+	}
+	if profile := ResolveProfile(Always, false); profile != TrueColor {
+		t.Errorf("always with NO_COLOR: expected TrueColor, got %v", profile)
+	}
+}
+
+func TestForeground(t *testing.T) {
+	cases := []struct {
+		color    RGB
+		profile  Profile
+		expected string
+	}{
+		{RGB{255, 182, 193}, TrueColor, "\033[38;2;255;182;193m"},
+		{RGB{255, 0, 0}, ANSI256, "\033[38;5;196m"},
+		{RGB{128, 128, 128}, ANSI256, "\033[38;5;244m"},
+		{RGB{255, 182, 193}, ANSI16, "\033[91m"},
+		{RGB{173, 216, 230}, ANSI16, "\033[36m"},
+		{RGB{255, 182, 193}, NoColor, ""},
+	}
+	for _, c := range cases {
+		if actual := c.color.Foreground(c.profile); actual != c.expected {
+			t.Errorf("%v with profile %d: expected %q, got %q", c.color, c.profile, c.expected, actual)
+		}
+	}
+}
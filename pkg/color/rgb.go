@@ -0,0 +1,136 @@
+package color
+
+import (
+	"fmt"
+)
+
+const Reset = "\033[0m"
+
+type RGB struct {
+	R uint8
+	G uint8
+	B uint8
+}
+
+var ansi16_palette = []RGB{
+	{0, 0, 0}, {205, 0, 0}, {0, 205, 0}, {205, 205, 0},
+	{0, 0, 238}, {205, 0, 205}, {0, 205, 205}, {229, 229, 229},
+	{127, 127, 127}, {255, 0, 0}, {0, 255, 0}, {255, 255, 0},
+	{92, 92, 255}, {255, 0, 255}, {0, 255, 255}, {255, 255, 255},
+}
+
+var cube_levels = []int{0, 95, 135, 175, 215, 255}
+
+// Foreground returns the escape sequence setting c as the text color, reduced
+// to the closest color the profile can show.
+func (c RGB) Foreground(profile Profile) string {
+	switch profile {
+	case TrueColor:
+		return fmt.Sprintf("\033[38;2;%d;%d;%dm", c.R, c.G, c.B)
+	case ANSI256:
+		return fmt.Sprintf("\033[38;5;%dm", c.ANSI256())
+	case ANSI16:
+		index := c.ANSI16()
+		if index < 8 {
+			return fmt.Sprintf("\033[%dm", 30+index)
+		}
+		return fmt.Sprintf("\033[%dm", 90+index-8)
+	}
+	return ""
+}
+
+func (c RGB) distance(other RGB) int {
+	dr := int(c.R) - int(other.R)
+	dg := int(c.G) - int(other.G)
+	db := int(c.B) - int(other.B)
+	return dr*dr + dg*dg + db*db
+}
+
+// ANSI16 picks the closest of the 16 basic colors. Tinted colors are stretched
+// to full saturation first, otherwise every pastel would end up as white.
+func (c RGB) ANSI16() int {
+	low := min(c.R, c.G, c.B)
+	high := max(c.R, c.G, c.B)
+	if high-low > 24 {
+		stretch := func(value uint8) uint8 {
+			return uint8(int(value-low) * 255 / int(high-low))
+		}
+		c = RGB{stretch(c.R), stretch(c.G), stretch(c.B)}
+	}
+
+	best := 0
+	for i, candidate := range ansi16_palette {
+		if c.distance(candidate) < c.distance(ansi16_palette[best]) {
+			best = i
+		}
+	}
+	return best
+}
+
+// ANSI256 picks the closest entry of the 6x6x6 color cube or the grayscale ramp.
+func (c RGB) ANSI256() int {
+	cube_index := func(value uint8) int {
+		best := 0
+		for i, level := range cube_levels {
+			if abs(int(value)-level) < abs(int(value)-cube_levels[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+	r, g, b := cube_index(c.R), cube_index(c.G), cube_index(c.B)
+	cube := RGB{uint8(cube_levels[r]), uint8(cube_levels[g]), uint8(cube_levels[b])}
+
+	average := (int(c.R) + int(c.G) + int(c.B)) / 3
+	gray_index := min(max((average-8)/10, 0), 23)
+	gray_level := uint8(8 + gray_index*10)
+	gray := RGB{gray_level, gray_level, gray_level}
+
+	if c.distance(gray) < c.distance(cube) {
+		return 232 + gray_index
+	}
+	return 16 + 36*r + 6*g + b
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func ParseHex(value string) (RGB, error) {
+	var c RGB
+	if len(value) != 7 || value[0] != '#' {
+		return c, fmt.Errorf("invalid color %q, expected #rrggbb", value)
+	}
+	if _, err := fmt.Sscanf(value, "#%02x%02x%02x", &c.R, &c.G, &c.B); err != nil {
+		return c, fmt.Errorf("invalid color %q, expected #rrggbb", value)
+	}
+	return c, nil
+}
+
+func (c RGB) Hex() string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func (c *RGB) UnmarshalText(text []byte) error {
+	parsed, err := ParseHex(string(text))
+	if err != nil {
+		return err
+	}
+	*c = parsed
+	return nil
+}
+
+func (c RGB) MarshalText() ([]byte, error) {
+	return []byte(c.Hex()), nil
+}
+
+// Paint wraps text in the foreground color, a nil color leaves it untouched.
+func Paint(c *RGB, profile Profile, text string) string {
+	if c == nil || profile == NoColor || text == "" {
+		return text
+	}
+	return c.Foreground(profile) + text + Reset
+}
@@ -1,99 +1,315 @@
 package commit
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	logger_pkg "git-graph/pkg/logger"
+	repo_pkg "git-graph/pkg/repo"
 )
 
+// Signature is the author or committer of a commit. Offset is the timezone
+// as written by git, e.g. "+0100".
+type Signature struct {
+	Name      string `json:"name"`
+	Email     string `json:"email,omitempty"`
+	Timestamp uint64 `json:"timestamp"`
+	Offset    string `json:"offset,omitempty"`
+}
+
+// Time returns the signature time in its original timezone.
+func (s Signature) Time() time.Time {
+	return time.Unix(int64(s.Timestamp), 0).In(time.FixedZone(s.Offset, offsetSeconds(s.Offset)))
+}
+
+func offsetSeconds(offset string) int {
+	if len(offset) != 5 || (offset[0] != '+' && offset[0] != '-') {
+		return 0
+	}
+	hours, err_hours := strconv.Atoi(offset[1:3])
+	minutes, err_minutes := strconv.Atoi(offset[3:5])
+	if err_hours != nil || err_minutes != nil {
+		return 0
+	}
+	seconds := hours*3600 + minutes*60
+	if offset[0] == '-' {
+		return -seconds
+	}
+	return seconds
+}
+
+// parseRawSignature reads the name, email and --date=raw fields printed by
+// git log.
+func parseRawSignature(name, email, date string) Signature {
+	signature := Signature{Name: name, Email: email}
+	timestamp, offset, _ := strings.Cut(date, " ")
+	signature.Timestamp, _ = strconv.ParseUint(timestamp, 10, 64)
+	signature.Offset = offset
+	return signature
+}
+
+// Commit is a node of the graph. Message is the subject line and Body the rest
+// of the message, Timestamp is the author time.
 type Commit struct {
 	Hash             string
 	Message          string
+	Body             string
 	Timestamp        uint64
+	Author           Signature
+	Committer        Signature
 	Parents          []string
-	HeadOfBranches   []string
+	Refs             []Ref
 	X_pos            int
 	Y_pos            int
 	GenerationNumber int
+	// Commits hidden behind the node: brought in by a collapsed merge in
+	// first-parent mode, or folded into a chain summary
+	Collapsed int
+	// Set on the node standing for a folded chain of Collapsed commits
+	Summary bool
 }
 
-func (c Commit) Format(message_max_length int) string {
-	hash_str := c.Hash[:8]
-	message_str := c.Message
-	time_str := time.Unix(int64(c.Timestamp), 0).Format("2006-01-02 15:04:05")
-	if len(message_str) > message_max_length {
-		message_str = message_str[:message_max_length-3] + "..."
+// CommitterTimestamp is the commit time git orders by, the author time when
+// the committer is not known, e.g. in older JSON files.
+func (c Commit) CommitterTimestamp() uint64 {
+	if c.Committer.Timestamp != 0 {
+		return c.Committer.Timestamp
 	}
-	branches_str := "( " + strings.Join(c.HeadOfBranches, ", ") + " )"
-	if len(c.HeadOfBranches) > 0 {
-		return fmt.Sprintf("%s %s %s %s", hash_str, message_str, time_str, branches_str)
+	return c.Timestamp
+}
+
+// AuthorSignature is Author with the time taken from Timestamp, which is set
+// even when the rest of the author is not known.
+func (c Commit) AuthorSignature() Signature {
+	signature := c.Author
+	signature.Timestamp = c.Timestamp
+	return signature
+}
+
+// CommitterSignature is Committer with the author time when it is not known.
+func (c Commit) CommitterSignature() Signature {
+	if c.Committer.Timestamp != 0 {
+		return c.Committer
 	}
-	return fmt.Sprintf("%s %s %s", hash_str, message_str, time_str)
+	return c.AuthorSignature()
 }
 
-var split_separator string = "␞"
-var format_string string = fmt.Sprintf("--format=%%H%s%%s%s%%P%s%%at%s%%D", split_separator, split_separator, split_separator, split_separator)
+// Fields are NUL terminated, no field of a commit can contain NUL
+var format_fields = []string{
+	"%H", "%s", "%P", "%at", "%D",
+	"%an", "%ae", "%ad",
+	"%cn", "%ce", "%cd",
+	"%b",
+}
+var format_string string = "--format=" + strings.Join(format_fields, "%x00")
 var logger = logger_pkg.GetDefaultLogger()
 
+// ParseCommits reads commits from the repository in the current directory
+// using DefaultSource.
 func ParseCommits(args []string) (map[string]Commit, error) {
-	// TODO: handle lack of repo
-	cmd := exec.Command("git", "log", format_string)
-	cmd.Args = append(cmd.Args, args...)
+	source, err := DefaultSource(args)
+	if err != nil {
+		return nil, err
+	}
+	return source.Commits()
+}
 
-	output, err := cmd.Output()
-	logger.Debug(string(output))
+func parseCommitsExec(args []string) (map[string]Commit, error) {
+	return collect(func(emit func(Commit) error) error {
+		return streamCommitsExec(args, emit)
+	})
+}
 
+// streamCommitsExec parses the output of git log while it is running, so the
+// first commits are available long before the last ones are printed.
+func streamCommitsExec(args []string, emit func(Commit) error) error {
+	annotated_tags, err := annotatedTagsExec()
 	if err != nil {
-		return nil, err
+		return err
+	}
+	worktrees, err := worktreesExec()
+	if err != nil {
+		return err
 	}
-	commits := make(map[string]Commit)
+	by_commit := worktreesByCommit(worktrees)
 
-	for index, line := range strings.Split(string(output), "\n") {
-		items := strings.Split(line, split_separator)
-		if len(items) < 5 {
-			continue
+	// -z ends the last field of every commit with NUL too
+	cmd := exec.Command("git", "log", "-z", "--decorate=full", "--date=raw", format_string)
+	cmd.Args = append(cmd.Args, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	log_args := append([]string{"log"}, args...)
+	if err := cmd.Start(); err != nil {
+		return gitError(log_args, "", err)
+	}
+
+	emit_decorated := func(c Commit) error {
+		if checked_out := by_commit[c.Hash]; len(checked_out) > 0 {
+			c.Refs = addWorktrees(c.Refs, checked_out)
 		}
-		parents := []string{}
-		if items[2] != "" {
-			parents = strings.Split(items[2], " ")
+		return emit(c)
+	}
+	if err := readCommitsExec(stdout, annotated_tags, emit_decorated); err != nil {
+		// git is stopped rather than left blocked on a full pipe
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	if err := cmd.Wait(); err != nil {
+		return gitError(log_args, stderr.String(), err)
+	}
+	return nil
+}
+
+// readCommitsExec parses the fields printed by git log with format_string,
+// every len(format_fields) fields make a commit.
+func readCommitsExec(r io.Reader, annotated_tags map[string]bool, emit func(Commit) error) error {
+	reader := bufio.NewReader(r)
+	items := make([]string, 0, len(format_fields))
+	index := 0
+	for {
+		field, read_err := reader.ReadString('\x00')
+		if read_err == io.EOF {
+			if field != "" || len(items) > 0 {
+				return fmt.Errorf("truncated git log output: %d of %d fields", len(items), len(format_fields))
+			}
+			return nil
 		}
+		if read_err != nil {
+			return read_err
+		}
+		items = append(items, strings.TrimSuffix(field, "\x00"))
+		if len(items) < len(format_fields) {
+			continue
+		}
+		logger.Debug(strings.Join(items, " | "))
 
-		timestamp, err := strconv.ParseUint(items[3], 10, 64)
+		c, err := parseRecord(items, annotated_tags)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		items = items[:0]
+		c.Y_pos = index
+		index++
+		if err := emit(c); err != nil {
+			return err
+		}
+	}
+}
+
+func parseRecord(items []string, annotated_tags map[string]bool) (Commit, error) {
+	parents := []string{}
+	if items[2] != "" {
+		parents = strings.Split(items[2], " ")
+	}
+
+	timestamp, err := strconv.ParseUint(items[3], 10, 64)
+	if err != nil {
+		return Commit{}, err
+	}
+
+	c := Commit{
+		Hash:      items[0],
+		Message:   items[1],
+		Body:      strings.TrimRight(items[11], "\n"),
+		Timestamp: timestamp,
+		Author:    parseRawSignature(items[5], items[6], items[7]),
+		Committer: parseRawSignature(items[8], items[9], items[10]),
+		Parents:   parents,
+		X_pos:     0,
+	}
+
+	c.Refs = ParseRefs(items[4])
+	for i := range c.Refs {
+		c.Refs[i].Annotated = annotated_tags[c.Refs[i].Name]
+	}
+	return c, nil
+}
+
+// annotatedTagsExec lists the tags pointing to a tag object, %D does not tell
+// them apart from lightweight tags.
+func annotatedTagsExec() (map[string]bool, error) {
+	args := []string{"for-each-ref", "--format=%(objecttype) %(refname)", "refs/tags"}
+	output, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return nil, gitError(args, "", err)
+	}
+	annotated := make(map[string]bool)
+	for _, line := range strings.Split(string(output), "\n") {
+		if name, found := strings.CutPrefix(line, "tag "); found {
+			annotated[name] = true
 		}
+	}
+	return annotated, nil
+}
 
-		c := Commit{
-			Hash:      items[0],
-			Message:   items[1],
-			Timestamp: timestamp,
-			Parents:   parents,
-			X_pos:     0,
-			Y_pos:     index,
+// worktreesExec reads `git worktree list`. The first worktree listed is the
+// main one, linked worktrees are found by the .git file their git directory
+// points back to.
+func worktreesExec() ([]repo_pkg.Worktree, error) {
+	args := []string{"worktree", "list", "--porcelain"}
+	output, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return nil, gitError(args, "", err)
+	}
+	current := ""
+	dirs_args := []string{"rev-parse", "--absolute-git-dir", "--git-common-dir"}
+	dirs, err := exec.Command("git", dirs_args...).Output()
+	if err != nil {
+		return nil, gitError(dirs_args, "", err)
+	}
+	git_dir, common_dir, _ := strings.Cut(strings.TrimSpace(string(dirs)), "\n")
+	if common_dir, _ = filepath.Abs(common_dir); common_dir != git_dir {
+		if content, err := os.ReadFile(filepath.Join(git_dir, "gitdir")); err == nil {
+			current = filepath.Dir(strings.TrimSpace(string(content)))
 		}
+	}
 
-		if items[4] != "" {
-			b := strings.Split(items[4], ",")
-			braches := make([]string, 0)
-			for _, branch := range b {
-				branch = strings.TrimSpace(branch)
-				braches = append(braches, branch)
+	worktrees := []repo_pkg.Worktree{}
+	for index, record := range strings.Split(strings.TrimSpace(string(output)), "\n\n") {
+		worktree := repo_pkg.Worktree{}
+		bare := false
+		for _, line := range strings.Split(record, "\n") {
+			key, value, _ := strings.Cut(line, " ")
+			switch key {
+			case "worktree":
+				worktree.Path = value
+			case "HEAD":
+				worktree.Hash = value
+			case "branch":
+				worktree.Branch = value
+			case "bare":
+				bare = true
 			}
-			c.HeadOfBranches = braches
 		}
-		commits[c.Hash] = c
+		if worktree.Path == "" || bare {
+			continue
+		}
+		if current == "" {
+			worktree.Current = index == 0
+		} else {
+			worktree.Current = filepath.Clean(worktree.Path) == filepath.Clean(current)
+		}
+		worktrees = append(worktrees, worktree)
 	}
-
-	return commits, nil
+	return worktrees, nil
 }
 
+// GetCommitStats returns the diffstat of a commit, without the header.
 func GetCommitStats(commit_hash string) string {
-	cmd := exec.Command("git", "show", "--stat", "--color=always", commit_hash)
+	cmd := exec.Command("git", "show", "--stat", "--format=", "--color=always", commit_hash)
 	cmd.Env = append(os.Environ(), "TERM=xterm-256color")
 
 	output, err := cmd.Output()
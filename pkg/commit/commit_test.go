@@ -0,0 +1,48 @@
+package commit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadCommitsExec(t *testing.T) {
+	record := func(fields ...string) string {
+		return strings.Join(fields, "\x00") + "\x00"
+	}
+	// Separators once used between fields are kept in the text
+	output := record("aaaaaaa2", "second ␞ | part", "aaaaaaa1", "120", "HEAD -> refs/heads/main, tag: refs/tags/v1",
+		"A U Thor", "author@example.com", "120 +0100", "C O Mitter", "committer@example.com", "180 -0230",
+		"line one ␞\nline two\n") +
+		record("aaaaaaa1", "first", "", "60", "", "A U Thor", "author@example.com", "60 +0100",
+			"A U Thor", "author@example.com", "60 +0100", "")
+
+	commits := []Commit{}
+	err := readCommitsExec(strings.NewReader(output), map[string]bool{"refs/tags/v1": true}, func(c Commit) error {
+		commits = append(commits, c)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 2 {
+		t.Fatalf("expected 2 commits, got %d", len(commits))
+	}
+	second, first := commits[0], commits[1]
+	if second.Y_pos != 0 || first.Y_pos != 1 {
+		t.Errorf("expected Y_pos in stream order, got %d and %d", second.Y_pos, first.Y_pos)
+	}
+	if second.Message != "second ␞ | part" || second.Body != "line one ␞\nline two" || second.Committer.Offset != "-0230" || second.CommitterTimestamp() != 180 {
+		t.Errorf("unexpected commit %+v", second)
+	}
+	if len(second.Refs) != 2 || second.Refs[0].Kind != RefHead || !second.Refs[1].Annotated {
+		t.Errorf("unexpected refs %+v", second.Refs)
+	}
+	if len(first.Parents) != 0 || first.Body != "" {
+		t.Errorf("unexpected root commit %+v", first)
+	}
+
+	truncated := record("aaaaaaa1", "first", "", "60", "")
+	if err := readCommitsExec(strings.NewReader(truncated), nil, func(Commit) error { return nil }); err == nil {
+		t.Error("expected an error for a truncated commit")
+	}
+}
@@ -0,0 +1,280 @@
+package commit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type DateMode int
+
+const (
+	DateDefault DateMode = iota
+	DateRelative
+	DateISO
+	DateISOStrict
+	DateRFC
+	DateShort
+	DateUnix
+	DateRaw
+	DateHuman
+	DateStrftime
+)
+
+var date_mode_names = map[string]DateMode{
+	"default":    DateDefault,
+	"relative":   DateRelative,
+	"iso":        DateISO,
+	"iso8601":    DateISO,
+	"iso-strict": DateISOStrict,
+	"rfc":        DateRFC,
+	"rfc2822":    DateRFC,
+	"short":      DateShort,
+	"unix":       DateUnix,
+	"raw":        DateRaw,
+	"human":      DateHuman,
+}
+
+type TimeZone int
+
+const (
+	ZoneLocal TimeZone = iota
+	ZoneUTC
+	ZoneOriginal
+)
+
+// DateFormat is how %ad and %cd are printed. The zero value prints
+// "2006-01-02 15:04:05" in local time.
+type DateFormat struct {
+	Mode DateMode
+	// strftime pattern of --date=format:...
+	Pattern string
+	Zone    TimeZone
+}
+
+// ParseDateFormat reads a mode in the syntax of git's --date option, e.g.
+// "relative", "iso-strict" or "format:%Y-%m-%d %H:%M", and a timezone: local,
+// utc or original. A "-local" suffix on the mode forces the local timezone.
+func ParseDateFormat(mode, zone string) (DateFormat, error) {
+	format := DateFormat{}
+	switch strings.ToLower(zone) {
+	case "", "local":
+		format.Zone = ZoneLocal
+	case "utc":
+		format.Zone = ZoneUTC
+	case "original":
+		format.Zone = ZoneOriginal
+	default:
+		return format, fmt.Errorf("unknown timezone %q, expected local, utc or original", zone)
+	}
+
+	if pattern, found := strings.CutPrefix(mode, "format:"); found {
+		format.Mode = DateStrftime
+		format.Pattern = pattern
+		return format, nil
+	}
+	if name, found := strings.CutSuffix(mode, "-local"); found {
+		mode = name
+		format.Zone = ZoneLocal
+	}
+	if mode == "" {
+		return format, nil
+	}
+	date_mode, exists := date_mode_names[mode]
+	if !exists {
+		return format, fmt.Errorf("unknown date format %q, expected default, relative, iso, iso-strict, rfc, short, unix, raw, human or format:...", mode)
+	}
+	format.Mode = date_mode
+	return format, nil
+}
+
+func (f DateFormat) Format(s Signature) string {
+	return f.format(s, time.Now())
+}
+
+func (f DateFormat) format(s Signature, now time.Time) string {
+	when := s.Time()
+	switch f.Zone {
+	case ZoneLocal:
+		when = when.In(time.Local)
+	case ZoneUTC:
+		when = when.UTC()
+	}
+
+	switch f.Mode {
+	case DateRelative:
+		return relativeDate(s.Timestamp, now)
+	case DateISO:
+		return when.Format("2006-01-02 15:04:05 -0700")
+	case DateISOStrict:
+		return when.Format("2006-01-02T15:04:05-07:00")
+	case DateRFC:
+		return when.Format("Mon, 2 Jan 2006 15:04:05 -0700")
+	case DateShort:
+		return when.Format("2006-01-02")
+	case DateUnix:
+		return strconv.FormatUint(s.Timestamp, 10)
+	case DateRaw:
+		return strconv.FormatUint(s.Timestamp, 10) + " " + when.Format("-0700")
+	case DateHuman:
+		return humanDate(s.Timestamp, when, now.In(time.Local))
+	case DateStrftime:
+		return strftime(f.Pattern, when)
+	}
+	return when.Format("2006-01-02 15:04:05")
+}
+
+// relativeDate follows the wording and rounding of git's --date=relative.
+func relativeDate(timestamp uint64, now time.Time) string {
+	seconds := now.Unix() - int64(timestamp)
+	if seconds < 0 {
+		return "in the future"
+	}
+	plural := func(count int64, unit string) string {
+		if count == 1 {
+			return fmt.Sprintf("%d %s", count, unit)
+		}
+		return fmt.Sprintf("%d %ss", count, unit)
+	}
+	if seconds < 90 {
+		return plural(seconds, "second") + " ago"
+	}
+	minutes := (seconds + 30) / 60
+	if minutes < 90 {
+		return plural(minutes, "minute") + " ago"
+	}
+	hours := (minutes + 30) / 60
+	if hours < 36 {
+		return plural(hours, "hour") + " ago"
+	}
+	days := (hours + 12) / 24
+	switch {
+	case days < 14:
+		return plural(days, "day") + " ago"
+	case days < 70:
+		return plural((days+3)/7, "week") + " ago"
+	case days < 365:
+		return plural((days+15)/30, "month") + " ago"
+	case days < 1825:
+		total_months := (days*12*2 + 365) / (365 * 2)
+		years, months := total_months/12, total_months%12
+		if months == 0 {
+			return plural(years, "year") + " ago"
+		}
+		return plural(years, "year") + ", " + plural(months, "month") + " ago"
+	}
+	return plural((days+183)/365, "year") + " ago"
+}
+
+// humanDate mirrors git's --date=human: dates from today are relative, the
+// last few days show the weekday and time, this year the month and day, and
+// older dates the day and year. The offset is shown when it differs from now.
+func humanDate(timestamp uint64, when, now time.Time) string {
+	_, offset := when.Zone()
+	_, now_offset := now.Zone()
+	hide_zone := offset == now_offset
+	hide_year := when.Year() == now.Year()
+	hide_date := false
+	if hide_year && when.Month() == now.Month() {
+		switch {
+		case when.Day() == now.Day():
+			return relativeDate(timestamp, now)
+		case when.Day() < now.Day() && when.Day()+5 > now.Day():
+			hide_date = true
+		}
+	}
+	hide_zone = hide_zone || !hide_date
+	hide_weekday_and_time := !hide_year
+
+	parts := []string{}
+	if !hide_weekday_and_time {
+		parts = append(parts, when.Format("Mon"))
+	}
+	if !hide_date {
+		parts = append(parts, when.Format("Jan 2"))
+	}
+	if !hide_weekday_and_time {
+		parts = append(parts, when.Format("15:04"))
+	}
+	if !hide_year {
+		parts = append(parts, strconv.Itoa(when.Year()))
+	}
+	if !hide_zone {
+		parts = append(parts, when.Format("-0700"))
+	}
+	return strings.Join(parts, " ")
+}
+
+// strftime supports the conversions of format:... that git passes to the C
+// library, in the C locale.
+func strftime(pattern string, when time.Time) string {
+	var result strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' || i == len(pattern)-1 {
+			result.WriteByte(pattern[i])
+			continue
+		}
+		i++
+		switch pattern[i] {
+		case 'Y':
+			result.WriteString(strconv.Itoa(when.Year()))
+		case 'y':
+			result.WriteString(when.Format("06"))
+		case 'm':
+			result.WriteString(when.Format("01"))
+		case 'd':
+			result.WriteString(when.Format("02"))
+		case 'e':
+			result.WriteString(when.Format("_2"))
+		case 'H':
+			result.WriteString(when.Format("15"))
+		case 'I':
+			result.WriteString(when.Format("03"))
+		case 'M':
+			result.WriteString(when.Format("04"))
+		case 'S':
+			result.WriteString(when.Format("05"))
+		case 'p':
+			result.WriteString(when.Format("PM"))
+		case 'a':
+			result.WriteString(when.Format("Mon"))
+		case 'A':
+			result.WriteString(when.Format("Monday"))
+		case 'b', 'h':
+			result.WriteString(when.Format("Jan"))
+		case 'B':
+			result.WriteString(when.Format("January"))
+		case 'j':
+			fmt.Fprintf(&result, "%03d", when.YearDay())
+		case 'u':
+			result.WriteString(strconv.Itoa((int(when.Weekday())+6)%7 + 1))
+		case 'w':
+			result.WriteString(strconv.Itoa(int(when.Weekday())))
+		case 'z':
+			result.WriteString(when.Format("-0700"))
+		case 'Z':
+			result.WriteString(when.Format("MST"))
+		case 's':
+			result.WriteString(strconv.FormatInt(when.Unix(), 10))
+		case 'F':
+			result.WriteString(when.Format("2006-01-02"))
+		case 'T':
+			result.WriteString(when.Format("15:04:05"))
+		case 'R':
+			result.WriteString(when.Format("15:04"))
+		case 'D':
+			result.WriteString(when.Format("01/02/06"))
+		case 'n':
+			result.WriteByte('\n')
+		case 't':
+			result.WriteByte('\t')
+		case '%':
+			result.WriteByte('%')
+		default:
+			result.WriteByte('%')
+			result.WriteByte(pattern[i])
+		}
+	}
+	return result.String()
+}
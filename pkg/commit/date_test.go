@@ -0,0 +1,74 @@
+package commit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRelativeDate(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	tests := []struct {
+		ago      time.Duration
+		expected string
+	}{
+		{30 * time.Second, "30 seconds ago"},
+		{5 * time.Minute, "5 minutes ago"},
+		{3 * time.Hour, "3 hours ago"},
+		{48 * time.Hour, "2 days ago"},
+		{20 * 24 * time.Hour, "3 weeks ago"},
+		{100 * 24 * time.Hour, "3 months ago"},
+		{800 * 24 * time.Hour, "2 years, 2 months ago"},
+	}
+	for _, test := range tests {
+		timestamp := uint64(now.Add(-test.ago).Unix())
+		if relative := relativeDate(timestamp, now); relative != test.expected {
+			t.Errorf("%v ago: expected %q, got %q", test.ago, test.expected, relative)
+		}
+	}
+}
+
+func TestDateFormat(t *testing.T) {
+	// human compares with the local timezone
+	local := time.Local
+	time.Local = time.UTC
+	defer func() { time.Local = local }()
+
+	// Wed Jan 3 10:00:00 2024 in India
+	signature := Signature{Timestamp: 1704256200, Offset: "+0530"}
+	now := time.Date(2024, time.January, 5, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		mode     string
+		zone     string
+		expected string
+	}{
+		{"default", "utc", "2024-01-03 04:30:00"},
+		{"iso", "original", "2024-01-03 10:00:00 +0530"},
+		{"iso-strict", "original", "2024-01-03T10:00:00+05:30"},
+		{"iso-strict", "utc", "2024-01-03T04:30:00+00:00"},
+		{"rfc", "original", "Wed, 3 Jan 2024 10:00:00 +0530"},
+		{"short", "original", "2024-01-03"},
+		{"unix", "original", "1704256200"},
+		{"raw", "original", "1704256200 +0530"},
+		{"relative", "utc", "2 days ago"},
+		{"human", "original", "Wed 10:00 +0530"},
+		{"human", "utc", "Wed 04:30"},
+		{"format:%d.%m.%y %H:%M %Z", "original", "03.01.24 10:00 +0530"},
+	}
+	for _, test := range tests {
+		format, err := ParseDateFormat(test.mode, test.zone)
+		if err != nil {
+			t.Errorf("ParseDateFormat(%q, %q): %v", test.mode, test.zone, err)
+			continue
+		}
+		if formatted := format.format(signature, now); formatted != test.expected {
+			t.Errorf("%s in %s: expected %q, got %q", test.mode, test.zone, test.expected, formatted)
+		}
+	}
+
+	if _, err := ParseDateFormat("yesterday", "local"); err == nil {
+		t.Error("expected an error for an unknown date format")
+	}
+	if _, err := ParseDateFormat("iso", "mars"); err == nil {
+		t.Error("expected an error for an unknown timezone")
+	}
+}
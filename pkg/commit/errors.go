@@ -0,0 +1,81 @@
+package commit
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	repo_pkg "git-graph/pkg/repo"
+)
+
+// The reasons reading commits fails, checked with errors.Is. The native
+// reader and `git log` report the same values.
+var (
+	ErrNotRepository   = repo_pkg.ErrNotRepository
+	ErrBadRevision     = repo_pkg.ErrBadRevision
+	ErrEmptyRange      = errors.New("no commits to show")
+	ErrGitNotInstalled = errors.New("git is not installed")
+)
+
+// GitError is a git command that failed, with what it printed on stderr.
+// Reason is one of the errors above when the message is recognized.
+type GitError struct {
+	Args     []string
+	ExitCode int
+	Stderr   string
+	Reason   error
+}
+
+func (e *GitError) Error() string {
+	message := fmt.Sprintf("git %s: exit status %d", strings.Join(e.Args, " "), e.ExitCode)
+	if e.Stderr != "" {
+		message += ": " + e.Stderr
+	}
+	return message
+}
+
+func (e *GitError) Unwrap() error {
+	return e.Reason
+}
+
+// Messages of git telling the reasons apart, lower case
+var git_error_reasons = []struct {
+	message string
+	reason  error
+}{
+	{"not a git repository", ErrNotRepository},
+	{"bad revision", ErrBadRevision},
+	{"unknown revision", ErrBadRevision},
+	{"bad default revision", ErrBadRevision},
+	{"ambiguous argument", ErrBadRevision},
+	{"invalid object name", ErrBadRevision},
+}
+
+// gitError turns the error of running git with args into a GitError, or
+// ErrGitNotInstalled when git could not be started.
+func gitError(args []string, stderr string, err error) error {
+	if errors.Is(err, exec.ErrNotFound) {
+		return ErrGitNotInstalled
+	}
+	var exit_err *exec.ExitError
+	if !errors.As(err, &exit_err) {
+		return err
+	}
+	if stderr == "" {
+		stderr = string(exit_err.Stderr)
+	}
+	git_err := &GitError{
+		Args:     args,
+		ExitCode: exit_err.ExitCode(),
+		Stderr:   strings.TrimSpace(stderr),
+	}
+	lower := strings.ToLower(git_err.Stderr)
+	for _, known := range git_error_reasons {
+		if strings.Contains(lower, known.message) {
+			git_err.Reason = known.reason
+			break
+		}
+	}
+	return git_err
+}
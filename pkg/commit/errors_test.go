@@ -0,0 +1,44 @@
+package commit
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+)
+
+func TestGitErrors(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	t.Setenv("GIT_CEILING_DIRECTORIES", dir)
+	t.Chdir(dir)
+
+	_, err := GitCLISource{Args: []string{"--all"}}.Commits()
+	if !errors.Is(err, ErrNotRepository) {
+		t.Errorf("expected a not a repository error, got %v", err)
+	}
+	var git_err *GitError
+	if !errors.As(err, &git_err) || git_err.Stderr == "" || git_err.ExitCode == 0 {
+		t.Errorf("expected git's exit code and stderr, got %#v", git_err)
+	}
+	if _, err := (NativeSource{Args: []string{"--all"}}).Commits(); !errors.Is(err, ErrNotRepository) {
+		t.Errorf("expected a not a repository error from the native reader, got %v", err)
+	}
+
+	if output, err := exec.Command("git", "init", "-q").CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, output)
+	}
+	for _, source := range []CommitSource{GitCLISource{Args: []string{"nope"}}, NativeSource{Args: []string{"nope"}}} {
+		if _, err := source.Commits(); !errors.Is(err, ErrBadRevision) {
+			t.Errorf("%T: expected a bad revision error, got %v", source, err)
+		}
+	}
+}
+
+func TestGitNotInstalled(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	if _, err := (GitCLISource{Args: []string{"--all"}}).Commits(); !errors.Is(err, ErrGitNotInstalled) {
+		t.Errorf("expected git not installed, got %v", err)
+	}
+}
@@ -0,0 +1,235 @@
+package commit
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	repo_pkg "git-graph/pkg/repo"
+)
+
+var errUnsupportedArgs = errors.New("arguments not supported by native reader")
+
+type revisionSet struct {
+	include []string
+	exclude []string
+}
+
+func parseCommitsNative(args []string) (map[string]Commit, error) {
+	return collect(func(emit func(Commit) error) error {
+		return streamCommitsNative(args, emit)
+	})
+}
+
+// streamCommitsNative calls emit on every commit as the walk reaches it.
+func streamCommitsNative(args []string, emit func(Commit) error) error {
+	repo, err := repo_pkg.Discover(".")
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	refs, err := repo.References()
+	if err != nil {
+		return err
+	}
+	head_target, head_hash, err := repo.Head()
+	if err != nil {
+		return err
+	}
+
+	worktrees, err := repo.Worktrees()
+	if err != nil {
+		return err
+	}
+
+	revisions, err := resolveRevisions(repo, args, refs, head_hash, worktrees)
+	if err != nil {
+		return err
+	}
+
+	decorations := RefDecorations(refs, head_target, head_hash, worktrees)
+	index := 0
+	return repo.WalkFunc(revisions.include, revisions.exclude, func(object *repo_pkg.CommitObject) error {
+		c := commitFromObject(repo, object, decorations)
+		c.Y_pos = index
+		index++
+		return emit(c)
+	})
+}
+
+// ReadCommitsNative reads the commits reachable from tips, stopping at the
+// commits in known. Refs are not set, except for grafted commits.
+func ReadCommitsNative(tips []string, known map[string]bool) (map[string]Commit, error) {
+	repo, err := repo_pkg.Discover(".")
+	if err != nil {
+		return nil, err
+	}
+	defer repo.Close()
+
+	decorations := make(map[string][]Ref)
+	return collect(func(emit func(Commit) error) error {
+		index := 0
+		return repo.WalkExcluding(tips, known, func(object *repo_pkg.CommitObject) error {
+			c := commitFromObject(repo, object, decorations)
+			c.Y_pos = index
+			index++
+			return emit(c)
+		})
+	})
+}
+
+func commitFromObject(repo *repo_pkg.Repository, object *repo_pkg.CommitObject, decorations map[string][]Ref) Commit {
+	refs := decorations[object.Hash]
+	if repo.IsShallow(object.Hash) {
+		refs = append(refs, NewRef("grafted"))
+	}
+	return Commit{
+		Hash:      object.Hash,
+		Message:   object.Subject(),
+		Body:      object.Body(),
+		Timestamp: uint64(max(object.Author.When, 0)),
+		Author:    signature(object.Author),
+		Committer: signature(object.Committer),
+		Parents:   object.Parents,
+		Refs:      refs,
+	}
+}
+
+func signature(s repo_pkg.Signature) Signature {
+	return Signature{Name: s.Name, Email: s.Email, Timestamp: uint64(max(s.When, 0)), Offset: s.Offset}
+}
+
+// resolveRevisions splits args into the commits to walk from and the ones to
+// stop at. Like git, --all also starts from the HEAD of every worktree.
+func resolveRevisions(repo *repo_pkg.Repository, args []string, refs []repo_pkg.Reference, head_hash string, worktrees []repo_pkg.Worktree) (revisionSet, error) {
+	revisions := revisionSet{}
+	add_refs := func(prefix string) {
+		for _, ref := range refs {
+			if strings.HasPrefix(ref.Name, prefix) {
+				revisions.include = append(revisions.include, ref.Commit())
+			}
+		}
+	}
+	// git log understands the revision syntax left out here
+	resolve := func(rev string) (string, error) {
+		if rev == "" {
+			rev = "HEAD"
+		}
+		hash, err := repo.ResolveRevision(rev)
+		if errors.Is(err, repo_pkg.ErrRevisionSyntax) {
+			return "", fmt.Errorf("%w: %s", errUnsupportedArgs, rev)
+		}
+		return hash, err
+	}
+
+	for _, arg := range args {
+		switch {
+		case arg == "--all":
+			add_refs("refs/")
+			if head_hash != "" {
+				revisions.include = append(revisions.include, head_hash)
+			}
+			for _, worktree := range worktrees {
+				if worktree.Hash != "" {
+					revisions.include = append(revisions.include, worktree.Hash)
+				}
+			}
+		case arg == "--branches":
+			add_refs("refs/heads/")
+		case arg == "--tags":
+			add_refs("refs/tags/")
+		case arg == "--remotes":
+			add_refs("refs/remotes/")
+		case strings.HasPrefix(arg, "-") || strings.Contains(arg, "...") || strings.Contains(arg, ":"):
+			return revisions, fmt.Errorf("%w: %s", errUnsupportedArgs, arg)
+		case strings.HasPrefix(arg, "^"):
+			hash, err := resolve(arg[1:])
+			if err != nil {
+				return revisions, err
+			}
+			revisions.exclude = append(revisions.exclude, hash)
+		case strings.Contains(arg, ".."):
+			from, to, _ := strings.Cut(arg, "..")
+			from_hash, err := resolve(from)
+			if err != nil {
+				return revisions, err
+			}
+			to_hash, err := resolve(to)
+			if err != nil {
+				return revisions, err
+			}
+			revisions.exclude = append(revisions.exclude, from_hash)
+			revisions.include = append(revisions.include, to_hash)
+		default:
+			hash, err := resolve(arg)
+			if err != nil {
+				return revisions, err
+			}
+			revisions.include = append(revisions.include, hash)
+		}
+	}
+
+	if len(args) == 0 && head_hash != "" {
+		revisions.include = append(revisions.include, head_hash)
+	}
+	return revisions, nil
+}
+
+// RefDecorations returns the refs of every commit as %D lists them: HEAD first,
+// then the other refs in reverse name order, with the checked out branch
+// folded into "HEAD -> name". The other worktrees follow HEAD.
+func RefDecorations(refs []repo_pkg.Reference, head_target, head_hash string, worktrees []repo_pkg.Worktree) map[string][]Ref {
+	decorations := make(map[string][]Ref)
+	for i := len(refs) - 1; i >= 0; i-- {
+		ref := refs[i]
+		if ref.Name == head_target && ref.Commit() == head_hash {
+			continue
+		}
+		decoration := NewRef(ref.Name)
+		decoration.Annotated = decoration.Kind == RefTag && ref.Peeled != ""
+		decorations[ref.Commit()] = append(decorations[ref.Commit()], decoration)
+	}
+
+	if head_hash != "" {
+		head := Ref{Name: "HEAD", Kind: RefHead, Target: head_target}
+		decorations[head_hash] = append([]Ref{head}, decorations[head_hash]...)
+	}
+	for hash, checked_out := range worktreesByCommit(worktrees) {
+		decorations[hash] = addWorktrees(decorations[hash], checked_out)
+	}
+	return decorations
+}
+
+// worktreesByCommit groups the worktrees other than the current one by the
+// commit they have checked out.
+func worktreesByCommit(worktrees []repo_pkg.Worktree) map[string][]repo_pkg.Worktree {
+	by_commit := make(map[string][]repo_pkg.Worktree)
+	for _, worktree := range worktrees {
+		if !worktree.Current && worktree.Hash != "" {
+			by_commit[worktree.Hash] = append(by_commit[worktree.Hash], worktree)
+		}
+	}
+	return by_commit
+}
+
+// addWorktrees inserts "worktree: name -> branch" decorations after HEAD,
+// the branches they have checked out are folded into them.
+func addWorktrees(refs []Ref, worktrees []repo_pkg.Worktree) []Ref {
+	result := make([]Ref, 0, len(refs)+len(worktrees))
+	if len(refs) > 0 && refs[0].Kind == RefHead {
+		result = append(result, refs[0])
+		refs = refs[1:]
+	}
+	checked_out := make(map[string]bool)
+	for _, worktree := range worktrees {
+		result = append(result, Ref{Name: worktree.Path, Kind: RefWorktree, Target: worktree.Branch})
+		checked_out[worktree.Branch] = true
+	}
+	for _, ref := range refs {
+		if ref.Kind != RefBranch || !checked_out[ref.Name] {
+			result = append(result, ref)
+		}
+	}
+	return result
+}
@@ -0,0 +1,147 @@
+package commit
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The native reader prints the same commits, in the same order, as git log
+func TestNativeMatchesGitLog(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_AUTHOR_NAME", "A U Thor")
+	t.Setenv("GIT_AUTHOR_EMAIL", "author@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "C O Mitter")
+	t.Setenv("GIT_COMMITTER_EMAIL", "committer@example.com")
+	// Every commit has the same dates, git log keeps them in walk order
+	t.Setenv("GIT_AUTHOR_DATE", "1700000000 -0230")
+	t.Setenv("GIT_COMMITTER_DATE", "1700000000 +0100")
+	t.Chdir(dir)
+	git := func(args ...string) {
+		t.Helper()
+		if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, output)
+		}
+	}
+	git("init", "-q", "-b", "main")
+	git("commit", "-q", "--allow-empty", "-m", "root")
+	git("commit", "-q", "--allow-empty", "-m", "second", "-m", "body line one\nbody line two")
+	git("tag", "-a", "-m", "release", "v1")
+	git("checkout", "-q", "-b", "topic")
+	git("commit", "-q", "--allow-empty", "-m", "topic one")
+	git("commit", "-q", "--allow-empty", "-m", "topic two")
+	git("tag", "light")
+	git("checkout", "-q", "main")
+	git("commit", "-q", "--allow-empty", "-m", "main three")
+	git("merge", "-q", "--no-ff", "-m", "merge topic", "topic")
+	git("checkout", "-q", "-b", "other", "v1")
+	git("commit", "-q", "--allow-empty", "-m", "other")
+	git("merge", "-q", "--no-ff", "-m", "merge main", "main")
+	git("checkout", "-q", "main")
+
+	for _, args := range [][]string{
+		{},
+		{"--all"},
+		{"--branches"},
+		{"--tags"},
+		{"v1"},
+		{"main~1..other"},
+		{"other", "^topic"},
+		{"topic", "main", "^v1"},
+	} {
+		native, err := NativeSource{Args: args}.Commits()
+		if err != nil {
+			t.Fatalf("native %v: %v", args, err)
+		}
+		exec_commits, err := GitCLISource{Args: args}.Commits()
+		if err != nil {
+			t.Fatalf("git log %v: %v", args, err)
+		}
+		if len(native) != len(exec_commits) {
+			t.Errorf("%v: native read %d commits, git log %d", args, len(native), len(exec_commits))
+		}
+		for hash, expected := range exec_commits {
+			if c := native[hash]; !reflect.DeepEqual(c, expected) {
+				t.Errorf("%v: native read\n%+v\ngit log\n%+v", args, c, expected)
+			}
+		}
+	}
+
+	// The native reader leaves the revision syntax it does not parse to git log
+	for _, args := range [][]string{{"HEAD^{commit}"}, {"v1^{}", "^main~2"}, {"main^!"}} {
+		if _, err := (NativeSource{Args: args}).Commits(); !errors.Is(err, errUnsupportedArgs) {
+			t.Errorf("%v: expected the native reader to leave the arguments to git log, got %v", args, err)
+		}
+		source, err := SourceForBackend("auto", args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		commits, err := source.Commits()
+		if err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+		expected, err := GitCLISource{Args: args}.Commits()
+		if err != nil {
+			t.Fatalf("git log %v: %v", args, err)
+		}
+		if !reflect.DeepEqual(commits, expected) {
+			t.Errorf("%v: expected the commits of git log, got %d commits instead of %d", args, len(commits), len(expected))
+		}
+	}
+}
+
+// git prints empty committer fields for a commit without a committer header
+func TestNativeMissingCommitter(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Chdir(t.TempDir())
+	git := func(stdin string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Stdin = strings.NewReader(stdin)
+		output, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+		return strings.TrimSpace(string(output))
+	}
+	git("", "init", "-q", "-b", "main")
+	tree := git("", "hash-object", "-t", "tree", "-w", "--stdin")
+	hash := git("tree "+tree+"\nauthor A U Thor <a u@example.com> 1700000000 -0230\n\nno committer\n",
+		"hash-object", "-t", "commit", "-w", "--literally", "--stdin")
+	git("", "update-ref", "refs/heads/main", hash)
+
+	native, err := NativeSource{}.Commits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exec_commits, err := GitCLISource{}.Commits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(native, exec_commits) {
+		t.Errorf("native read\n%+v\ngit log\n%+v", native, exec_commits)
+	}
+	c := native[hash]
+	expected_author := Signature{Name: "A U Thor", Email: "a u@example.com", Timestamp: 1700000000, Offset: "-0230"}
+	if c.Author != expected_author || c.Committer != (Signature{}) {
+		t.Errorf("unexpected signatures %+v", c)
+	}
+	if c.CommitterTimestamp() != 1700000000 || c.CommitterSignature() != expected_author {
+		t.Errorf("expected the author time for the committer, got %+v", c.CommitterSignature())
+	}
+	if offset := c.Author.Time().Format("-0700"); offset != "-0230" {
+		t.Errorf("expected the author time at -0230, got %s", offset)
+	}
+}
@@ -0,0 +1,201 @@
+package commit
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+type RefKind int
+
+const (
+	RefHead RefKind = iota
+	RefBranch
+	RefRemoteBranch
+	RefTag
+	RefStash
+	RefNotes
+	RefGrafted
+	RefOther
+	RefWorktree
+)
+
+var ref_kind_names = map[RefKind]string{
+	RefHead:         "head",
+	RefBranch:       "branch",
+	RefRemoteBranch: "remote",
+	RefTag:          "tag",
+	RefStash:        "stash",
+	RefNotes:        "notes",
+	RefGrafted:      "grafted",
+	RefOther:        "other",
+	RefWorktree:     "worktree",
+}
+
+func (k RefKind) String() string {
+	return ref_kind_names[k]
+}
+
+func (k RefKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *RefKind) UnmarshalText(text []byte) error {
+	for kind, name := range ref_kind_names {
+		if name == string(text) {
+			*k = kind
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown ref kind %q", text)
+}
+
+// Ref is a decoration of a commit. Name is the full ref name ("HEAD" and
+// "grafted" for the pseudo refs, the path for another worktree), Target the
+// full name of the branch HEAD or the worktree points to, empty when
+// detached.
+type Ref struct {
+	Name      string  `json:"name"`
+	Kind      RefKind `json:"kind"`
+	Target    string  `json:"target,omitempty"`
+	Annotated bool    `json:"annotated,omitempty"`
+}
+
+func NewRef(name string) Ref {
+	return Ref{Name: name, Kind: refKind(name)}
+}
+
+func refKind(name string) RefKind {
+	switch {
+	case name == "HEAD":
+		return RefHead
+	case name == "grafted":
+		return RefGrafted
+	case name == "refs/stash":
+		return RefStash
+	case strings.HasPrefix(name, "refs/heads/"):
+		return RefBranch
+	case strings.HasPrefix(name, "refs/remotes/"):
+		return RefRemoteBranch
+	case strings.HasPrefix(name, "refs/tags/"):
+		return RefTag
+	case strings.HasPrefix(name, "refs/notes/"):
+		return RefNotes
+	}
+	return RefOther
+}
+
+// ShortName strips the refs/heads/, refs/remotes/ and refs/tags/ prefixes
+// like git does when printing decorations.
+func (r Ref) ShortName() string {
+	return shortRefName(r.Name)
+}
+
+func shortRefName(name string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/remotes/", "refs/tags/"} {
+		if strings.HasPrefix(name, prefix) {
+			return strings.TrimPrefix(name, prefix)
+		}
+	}
+	return name
+}
+
+// String formats the ref like the %D placeholder of git log.
+func (r Ref) String() string {
+	switch r.Kind {
+	case RefHead:
+		if r.Target != "" {
+			return "HEAD -> " + shortRefName(r.Target)
+		}
+		return "HEAD"
+	case RefWorktree:
+		if r.Target != "" {
+			return "worktree: " + filepath.Base(r.Name) + " -> " + shortRefName(r.Target)
+		}
+		return "worktree: " + filepath.Base(r.Name)
+	case RefTag:
+		return "tag: " + r.ShortName()
+	}
+	return r.ShortName()
+}
+
+// ParseRef reads one entry of a %D list. Full ref names, as printed with
+// --decorate=full, keep their kind; short names are taken as local branches.
+func ParseRef(decoration string) Ref {
+	decoration = strings.TrimSpace(decoration)
+	if target, found := strings.CutPrefix(decoration, "HEAD -> "); found {
+		return Ref{Name: "HEAD", Kind: RefHead, Target: fullBranchName(target)}
+	}
+	if worktree, found := strings.CutPrefix(decoration, "worktree: "); found {
+		name, target, _ := strings.Cut(worktree, " -> ")
+		if target != "" {
+			target = fullBranchName(target)
+		}
+		return Ref{Name: name, Kind: RefWorktree, Target: target}
+	}
+	if tag, found := strings.CutPrefix(decoration, "tag: "); found {
+		if !strings.HasPrefix(tag, "refs/") {
+			tag = "refs/tags/" + tag
+		}
+		return Ref{Name: tag, Kind: RefTag}
+	}
+	if decoration == "HEAD" || decoration == "grafted" || strings.HasPrefix(decoration, "refs/") {
+		return NewRef(decoration)
+	}
+	return Ref{Name: "refs/heads/" + decoration, Kind: RefBranch}
+}
+
+func fullBranchName(name string) string {
+	if strings.HasPrefix(name, "refs/") {
+		return name
+	}
+	return "refs/heads/" + name
+}
+
+// ParseRefs splits a %D list on commas.
+func ParseRefs(decorations string) []Ref {
+	if strings.TrimSpace(decorations) == "" {
+		return nil
+	}
+	items := strings.Split(decorations, ",")
+	refs := make([]Ref, len(items))
+	for i, item := range items {
+		refs[i] = ParseRef(item)
+	}
+	return refs
+}
+
+func FormatRefs(refs []Ref) string {
+	names := make([]string, len(refs))
+	for i, ref := range refs {
+		names[i] = ref.String()
+	}
+	return strings.Join(names, ", ")
+}
+
+// UnmarshalJSON also accepts the plain %D strings used by older JSON files.
+// The kind is derived from the name when it is missing.
+func (r *Ref) UnmarshalJSON(data []byte) error {
+	var decoration string
+	if err := json.Unmarshal(data, &decoration); err == nil {
+		*r = ParseRef(decoration)
+		return nil
+	}
+	var ref struct {
+		Name      string   `json:"name"`
+		Kind      *RefKind `json:"kind"`
+		Target    string   `json:"target"`
+		Annotated bool     `json:"annotated"`
+	}
+	if err := json.Unmarshal(data, &ref); err != nil {
+		return err
+	}
+	*r = NewRef(ref.Name)
+	if ref.Kind != nil {
+		r.Kind = *ref.Kind
+	}
+	r.Target = ref.Target
+	r.Annotated = ref.Annotated
+	return nil
+}
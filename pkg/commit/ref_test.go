@@ -0,0 +1,62 @@
+package commit
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseRefs(t *testing.T) {
+	tests := []struct {
+		decoration string
+		expected   Ref
+	}{
+		{"HEAD -> main", Ref{Name: "HEAD", Kind: RefHead, Target: "refs/heads/main"}},
+		{"HEAD -> refs/heads/main", Ref{Name: "HEAD", Kind: RefHead, Target: "refs/heads/main"}},
+		{"HEAD", Ref{Name: "HEAD", Kind: RefHead}},
+		{"tag: v1.0", Ref{Name: "refs/tags/v1.0", Kind: RefTag}},
+		{"tag: refs/tags/v1.0", Ref{Name: "refs/tags/v1.0", Kind: RefTag}},
+		{"refs/remotes/origin/main", Ref{Name: "refs/remotes/origin/main", Kind: RefRemoteBranch}},
+		{"refs/stash", Ref{Name: "refs/stash", Kind: RefStash}},
+		{"refs/notes/commits", Ref{Name: "refs/notes/commits", Kind: RefNotes}},
+		{"grafted", Ref{Name: "grafted", Kind: RefGrafted}},
+		{"feature/x", Ref{Name: "refs/heads/feature/x", Kind: RefBranch}},
+		{"worktree: wt -> feat", Ref{Name: "wt", Kind: RefWorktree, Target: "refs/heads/feat"}},
+		{"worktree: wt", Ref{Name: "wt", Kind: RefWorktree}},
+	}
+	for _, test := range tests {
+		if ref := ParseRef(test.decoration); ref != test.expected {
+			t.Errorf("ParseRef(%q) = %+v, expected %+v", test.decoration, ref, test.expected)
+		}
+	}
+
+	refs := ParseRefs("HEAD -> refs/heads/main, tag: refs/tags/v1, refs/remotes/origin/main, refs/stash")
+	if formatted := FormatRefs(refs); formatted != "HEAD -> main, tag: v1, origin/main, refs/stash" {
+		t.Errorf("unexpected %%D format %q", formatted)
+	}
+}
+
+func TestRefJSON(t *testing.T) {
+	refs := []Ref{
+		{Name: "HEAD", Kind: RefHead, Target: "refs/heads/main"},
+		{Name: "refs/tags/v1", Kind: RefTag, Annotated: true},
+	}
+	data, err := json.Marshal(refs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded []Ref
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 2 || decoded[0] != refs[0] || decoded[1] != refs[1] {
+		t.Errorf("round trip through %s gave %+v", data, decoded)
+	}
+
+	// Older files store the %D strings, objects without a kind derive it from the name
+	if err := json.Unmarshal([]byte(`["HEAD -> main", {"name": "refs/remotes/origin/main"}]`), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded[0].Target != "refs/heads/main" || decoded[1].Kind != RefRemoteBranch {
+		t.Errorf("unexpected refs %+v", decoded)
+	}
+}
@@ -0,0 +1,318 @@
+package commit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	repo_pkg "git-graph/pkg/repo"
+)
+
+// CommitSource provides the commits graph.ProcessCommits lays out. Every
+// implementation returns commits keyed by hash with Y_pos set to the order
+// the commits were produced in.
+type CommitSource interface {
+	Commits() (map[string]Commit, error)
+}
+
+// StreamingSource is a CommitSource that can also hand out its commits one
+// by one, in the order of Y_pos, while the rest are still being read.
+type StreamingSource interface {
+	CommitSource
+	Stream(emit func(Commit) error) error
+}
+
+// Stream calls emit on every commit of source in the order of Y_pos. Sources
+// that cannot stream are read completely first. An error returned by emit
+// stops the stream and is returned.
+func Stream(source CommitSource, emit func(Commit) error) error {
+	if streaming, ok := source.(StreamingSource); ok {
+		return streaming.Stream(emit)
+	}
+	commits, err := source.Commits()
+	if err != nil {
+		return err
+	}
+	sorted_commits := make([]Commit, 0, len(commits))
+	for _, c := range commits {
+		sorted_commits = append(sorted_commits, c)
+	}
+	sort.Slice(sorted_commits, func(i, j int) bool {
+		return sorted_commits[i].Y_pos < sorted_commits[j].Y_pos
+	})
+	for _, c := range sorted_commits {
+		if err := emit(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collect gathers a stream into the map returned by CommitSource.Commits.
+func collect(stream func(emit func(Commit) error) error) (map[string]Commit, error) {
+	commits := make(map[string]Commit)
+	err := stream(func(c Commit) error {
+		commits[c.Hash] = c
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return commits, nil
+}
+
+type GitCLISource struct {
+	Args []string
+}
+
+func (s GitCLISource) Commits() (map[string]Commit, error) {
+	return parseCommitsExec(s.Args)
+}
+
+func (s GitCLISource) Stream(emit func(Commit) error) error {
+	return streamCommitsExec(s.Args, emit)
+}
+
+type NativeSource struct {
+	Args []string
+}
+
+func (s NativeSource) Commits() (map[string]Commit, error) {
+	return parseCommitsNative(s.Args)
+}
+
+func (s NativeSource) Stream(emit func(Commit) error) error {
+	return streamCommitsNative(s.Args, emit)
+}
+
+type fallbackSource struct {
+	primary  StreamingSource
+	fallback StreamingSource
+}
+
+func (s fallbackSource) Commits() (map[string]Commit, error) {
+	return collect(s.Stream)
+}
+
+// Stream falls back when the native reader does not support the arguments
+// or the repository format, which it finds out before emitting anything.
+// Other errors, such as a bad revision, are what git log would report too.
+func (s fallbackSource) Stream(emit func(Commit) error) error {
+	err := s.primary.Stream(emit)
+	if !errors.Is(err, errUnsupportedArgs) && !errors.Is(err, repo_pkg.ErrUnsupported) {
+		return err
+	}
+	logger.Debug(fmt.Sprintf("native reader failed, falling back to git log: %v", err))
+	return s.fallback.Stream(emit)
+}
+
+// BACKENDS are the values of GRAPH_GIT_BACKEND and git.backend, auto reads
+// commits natively and falls back to git log.
+var BACKENDS = []string{"auto", "native", "exec"}
+
+// DefaultSource reads commits straight from the .git directory and falls back
+// to `git log` when the native reader cannot handle the repository or args.
+// Setting GRAPH_GIT_BACKEND to "exec" or "native" forces one of them.
+func DefaultSource(args []string) (CommitSource, error) {
+	return SourceForBackend(os.Getenv("GRAPH_GIT_BACKEND"), args)
+}
+
+// SourceForBackend is DefaultSource with the backend given explicitly, empty
+// meaning auto.
+func SourceForBackend(backend string, args []string) (CommitSource, error) {
+	switch backend {
+	case "", "auto":
+		return fallbackSource{NativeSource{Args: args}, GitCLISource{Args: args}}, nil
+	case "exec":
+		return GitCLISource{Args: args}, nil
+	case "native":
+		return NativeSource{Args: args}, nil
+	}
+	return nil, fmt.Errorf("unknown git backend %q, expected one of: %s", backend, strings.Join(BACKENDS, ", "))
+}
+
+// JSONCommit is the fixture format read by JSONSource. It is a superset of
+// the file written with GRAPH_SAVE_JSON, so saved graphs can be replayed.
+type JSONCommit struct {
+	Hash      string     `json:"hash"`
+	Message   string     `json:"message"`
+	Body      string     `json:"body,omitempty"`
+	Timestamp uint64     `json:"timestamp"`
+	Author    *Signature `json:"author,omitempty"`
+	Committer *Signature `json:"committer,omitempty"`
+	Parents   []string   `json:"parents"`
+	Refs      []Ref      `json:"refs,omitempty"`
+}
+
+// NewJSONCommit converts c to the JSON format, leaving out the signatures
+// when they are not known.
+func NewJSONCommit(c Commit) JSONCommit {
+	item := JSONCommit{
+		Hash:      c.Hash,
+		Message:   c.Message,
+		Body:      c.Body,
+		Timestamp: c.Timestamp,
+		Parents:   c.Parents,
+		Refs:      c.Refs,
+	}
+	if c.Author != (Signature{}) {
+		item.Author = &c.Author
+	}
+	if c.Committer != (Signature{}) {
+		item.Committer = &c.Committer
+	}
+	return item
+}
+
+type JSONSource struct {
+	Path string
+}
+
+func (s JSONSource) Commits() (map[string]Commit, error) {
+	file, err := os.Open(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	commits, err := ReadJSON(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.Path, err)
+	}
+	return commits, nil
+}
+
+func ReadJSON(r io.Reader) (map[string]Commit, error) {
+	var items []JSONCommit
+	if err := json.NewDecoder(r).Decode(&items); err != nil {
+		return nil, err
+	}
+
+	// Files saved with GRAPH_SAVE_JSON also contain the dummy commits added by
+	// the layout, they are replaced by the parent they stand for
+	dummy_parents := make(map[string]string)
+	for _, item := range items {
+		if strings.HasPrefix(item.Hash, "dummy_") && len(item.Parents) == 1 {
+			dummy_parents[item.Hash] = item.Parents[0]
+		}
+	}
+
+	builder := NewBuilder()
+	for _, item := range items {
+		if _, exists := dummy_parents[item.Hash]; exists {
+			continue
+		}
+		parents := make([]string, len(item.Parents))
+		for i, parent_hash := range item.Parents {
+			for {
+				real_parent, exists := dummy_parents[parent_hash]
+				if !exists {
+					break
+				}
+				parent_hash = real_parent
+			}
+			parents[i] = parent_hash
+		}
+		c := Commit{
+			Hash:      item.Hash,
+			Message:   item.Message,
+			Body:      item.Body,
+			Timestamp: item.Timestamp,
+			Parents:   parents,
+			Refs:      item.Refs,
+		}
+		if item.Author != nil {
+			c.Author = *item.Author
+		}
+		if item.Committer != nil {
+			c.Committer = *item.Committer
+		}
+		builder.Commit(c)
+	}
+	return builder.Commits()
+}
+
+// WriteJSON stores commits in the JSONSource format, ordered by Y_pos and hash
+// so that the output is stable.
+func WriteJSON(w io.Writer, commits map[string]Commit) error {
+	sorted_commits := make([]Commit, 0, len(commits))
+	for _, c := range commits {
+		sorted_commits = append(sorted_commits, c)
+	}
+	sort.Slice(sorted_commits, func(i, j int) bool {
+		if sorted_commits[i].Y_pos == sorted_commits[j].Y_pos {
+			return sorted_commits[i].Hash < sorted_commits[j].Hash
+		}
+		return sorted_commits[i].Y_pos < sorted_commits[j].Y_pos
+	})
+
+	items := make([]JSONCommit, len(sorted_commits))
+	for i, c := range sorted_commits {
+		items[i] = NewJSONCommit(c)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	return encoder.Encode(items)
+}
+
+// Builder assembles a commit graph in memory, mostly for tests and tools that
+// do not have a repository at hand.
+type Builder struct {
+	commits []Commit
+}
+
+const builder_time_step = 60
+
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+// Add appends a commit. Commits get increasing timestamps in the order they
+// are added, so add parents before their children.
+func (b *Builder) Add(hash, message string, parents ...string) *Builder {
+	return b.Commit(Commit{
+		Hash:      hash,
+		Message:   message,
+		Timestamp: uint64(len(b.commits)+1) * builder_time_step,
+		Parents:   parents,
+	})
+}
+
+// Refs sets the ref decorations of an already added commit, given as %D
+// entries like "HEAD -> main" or "tag: v1.0".
+func (b *Builder) Refs(hash string, refs ...string) *Builder {
+	for i := range b.commits {
+		if b.commits[i].Hash == hash {
+			b.commits[i].Refs = ParseRefs(strings.Join(refs, ","))
+		}
+	}
+	return b
+}
+
+func (b *Builder) Commit(c Commit) *Builder {
+	b.commits = append(b.commits, c)
+	return b
+}
+
+func (b *Builder) Commits() (map[string]Commit, error) {
+	commits := make(map[string]Commit)
+	for index, c := range b.commits {
+		if len(c.Hash) < 8 {
+			return nil, fmt.Errorf("commit hash %q is shorter than 8 characters", c.Hash)
+		}
+		if _, exists := commits[c.Hash]; exists {
+			return nil, fmt.Errorf("duplicated commit %s", c.Hash)
+		}
+		if c.Parents == nil {
+			c.Parents = []string{}
+		}
+		c.Y_pos = index
+		commits[c.Hash] = c
+	}
+	return commits, nil
+}
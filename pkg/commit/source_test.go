@@ -0,0 +1,173 @@
+package commit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	repo_pkg "git-graph/pkg/repo"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	commits, err := NewBuilder().
+		Add("aaaaaaaa", "root").
+		Commit(Commit{
+			Hash:      "bbbbbbbb",
+			Message:   "second",
+			Body:      "body line one\nbody line two",
+			Timestamp: 120,
+			Author:    Signature{Name: "A U Thor", Email: "author@example.com", Timestamp: 120, Offset: "-0230"},
+			Committer: Signature{Name: "C O Mitter", Email: "committer@example.com", Timestamp: 180, Offset: "+0100"},
+			Parents:   []string{"aaaaaaaa"},
+		}).
+		Add("cccccccc", "merge", "bbbbbbbb", "aaaaaaaa").
+		Refs("cccccccc", "HEAD -> refs/heads/main", "tag: refs/tags/v1").
+		Commits()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buffer bytes.Buffer
+	if err := WriteJSON(&buffer, commits); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "commits.json")
+	if err := os.WriteFile(path, buffer.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	read, err := JSONSource{Path: path}.Commits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, commits) {
+		t.Errorf("expected\n%+v\ngot\n%+v", commits, read)
+	}
+	if strings.Count(buffer.String(), `"author"`) != 1 {
+		t.Errorf("expected only the known author written:\n%s", buffer.String())
+	}
+
+	if _, err := (JSONSource{Path: filepath.Join(t.TempDir(), "missing.json")}).Commits(); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+// Files saved with GRAPH_SAVE_JSON have dummy commits between a commit and
+// its parent
+func TestReadJSONDummies(t *testing.T) {
+	commits, err := ReadJSON(strings.NewReader(`[
+		{"hash": "bbbbbbbb", "message": "child", "timestamp": 2, "parents": ["dummy_00"]},
+		{"hash": "dummy_00", "message": "", "timestamp": 0, "parents": ["dummy_01"]},
+		{"hash": "dummy_01", "message": "", "timestamp": 0, "parents": ["aaaaaaaa"]},
+		{"hash": "aaaaaaaa", "message": "parent", "timestamp": 1, "parents": []}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 2 || !reflect.DeepEqual(commits["bbbbbbbb"].Parents, []string{"aaaaaaaa"}) {
+		t.Errorf("expected the dummies replaced by their parent, got %+v", commits)
+	}
+	if commits["bbbbbbbb"].Y_pos != 0 || commits["aaaaaaaa"].Y_pos != 1 {
+		t.Errorf("expected rows in file order, got %+v", commits)
+	}
+}
+
+func TestBuilderErrors(t *testing.T) {
+	if _, err := NewBuilder().Add("short", "a").Commits(); err == nil {
+		t.Error("expected an error for a short hash")
+	}
+	if _, err := NewBuilder().Add("aaaaaaaa", "a").Add("aaaaaaaa", "b").Commits(); err == nil {
+		t.Error("expected an error for a duplicated commit")
+	}
+}
+
+// stubSource emits commits then returns err
+type stubSource struct {
+	commits []Commit
+	err     error
+	calls   *int
+}
+
+func (s stubSource) Commits() (map[string]Commit, error) {
+	return collect(s.Stream)
+}
+
+func (s stubSource) Stream(emit func(Commit) error) error {
+	*s.calls++
+	for _, c := range s.commits {
+		if err := emit(c); err != nil {
+			return err
+		}
+	}
+	return s.err
+}
+
+func TestFallbackSource(t *testing.T) {
+	native_commit := Commit{Hash: "aaaaaaaa", Message: "native"}
+	exec_commit := Commit{Hash: "bbbbbbbb", Message: "exec"}
+	failure := errors.New("corrupt pack")
+	for _, test := range []struct {
+		name           string
+		native         stubSource
+		expected       []string
+		expected_error error
+		falls_back     bool
+	}{
+		{"success", stubSource{commits: []Commit{native_commit}}, []string{"aaaaaaaa"}, nil, false},
+		{"unsupported args", stubSource{err: fmt.Errorf("%w: --since", errUnsupportedArgs)}, []string{"bbbbbbbb"}, nil, true},
+		{"unsupported repository", stubSource{err: fmt.Errorf("%w: object format sha256", repo_pkg.ErrUnsupported)}, []string{"bbbbbbbb"}, nil, true},
+		{"bad revision", stubSource{err: fmt.Errorf("%w: nope", ErrBadRevision)}, nil, ErrBadRevision, false},
+		{"not a repository", stubSource{err: ErrNotRepository}, nil, ErrNotRepository, false},
+		{"other error", stubSource{err: failure}, nil, failure, false},
+		{"error after commits", stubSource{commits: []Commit{native_commit}, err: failure}, []string{"aaaaaaaa"}, failure, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			native_calls, exec_calls := 0, 0
+			test.native.calls = &native_calls
+			source := fallbackSource{test.native, stubSource{commits: []Commit{exec_commit}, calls: &exec_calls}}
+			emitted := []string{}
+			err := source.Stream(func(c Commit) error {
+				emitted = append(emitted, c.Hash)
+				return nil
+			})
+			if !errors.Is(err, test.expected_error) || (err == nil) != (test.expected_error == nil) {
+				t.Errorf("expected error %v, got %v", test.expected_error, err)
+			}
+			if strings.Join(emitted, ",") != strings.Join(test.expected, ",") {
+				t.Errorf("expected commits %v, got %v", test.expected, emitted)
+			}
+			if (exec_calls == 1) != test.falls_back {
+				t.Errorf("expected falling back %t, git log was called %d times", test.falls_back, exec_calls)
+			}
+		})
+	}
+}
+
+func TestSourceForBackend(t *testing.T) {
+	for backend, expected := range map[string]CommitSource{
+		"":       fallbackSource{NativeSource{}, GitCLISource{}},
+		"auto":   fallbackSource{NativeSource{}, GitCLISource{}},
+		"native": NativeSource{},
+		"exec":   GitCLISource{},
+	} {
+		t.Setenv("GRAPH_GIT_BACKEND", backend)
+		source, err := DefaultSource(nil)
+		if err != nil {
+			t.Errorf("%q: %v", backend, err)
+		} else if reflect.TypeOf(source) != reflect.TypeOf(expected) {
+			t.Errorf("%q: expected a %T, got a %T", backend, expected, source)
+		}
+	}
+
+	t.Setenv("GRAPH_GIT_BACKEND", "libgit2")
+	if _, err := DefaultSource(nil); err == nil {
+		t.Error("expected an error for an unknown backend")
+	}
+	if _, err := ParseCommits(nil); err == nil {
+		t.Error("expected ParseCommits to fail with an unknown backend")
+	}
+}
@@ -0,0 +1,352 @@
+package commit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	text_pkg "git-graph/pkg/text"
+)
+
+// Placeholder is a field of a commit expanded by a Template.
+type Placeholder int
+
+const (
+	Literal Placeholder = iota
+	HashFull
+	HashShort
+	ParentsFull
+	ParentsShort
+	Subject
+	BodyText
+	AuthorName
+	AuthorEmail
+	AuthorDate
+	AuthorDateRelative
+	AuthorDateUnix
+	CommitterName
+	CommitterEmail
+	CommitterDate
+	CommitterDateRelative
+	CommitterDateUnix
+	Decorations
+	DecorationsBare
+)
+
+// Placeholders follow git log --pretty=format, longest names first so that
+// %an is not read as %a followed by "n".
+var placeholder_names = []struct {
+	name        string
+	placeholder Placeholder
+}{
+	{"an", AuthorName},
+	{"ae", AuthorEmail},
+	{"ad", AuthorDate},
+	{"ar", AuthorDateRelative},
+	{"at", AuthorDateUnix},
+	{"cn", CommitterName},
+	{"ce", CommitterEmail},
+	{"cd", CommitterDate},
+	{"cr", CommitterDateRelative},
+	{"ct", CommitterDateUnix},
+	{"H", HashFull},
+	{"h", HashShort},
+	{"P", ParentsFull},
+	{"p", ParentsShort},
+	{"s", Subject},
+	{"b", BodyText},
+	{"d", Decorations},
+	{"D", DecorationsBare},
+}
+
+type Align int
+
+const (
+	AlignNone Align = iota
+	AlignLeft
+	AlignRight
+	AlignCenter
+)
+
+type Truncate int
+
+const (
+	NoTruncate Truncate = iota
+	TruncateRight
+	TruncateLeft
+	TruncateMiddle
+)
+
+type segment struct {
+	placeholder Placeholder
+	literal     string
+	// "% x" adds a space before the expansion when it is not empty
+	space_before bool
+	align        Align
+	truncate     Truncate
+	width        int
+	// %<|(N) pads up to column N instead of to a width of N
+	column bool
+}
+
+// Template is a parsed commit line format like "%h %s %an %ar%d".
+type Template struct {
+	Source string
+	// Format of %ad and %cd
+	Dates    DateFormat
+	segments []segment
+}
+
+const short_hash_length = 8
+
+// PRESETS are the named formats accepted by ParseTemplate. Commit lines are
+// drawn on a single row, so they never contain %n.
+var PRESETS = map[string]string{
+	"default": "%h %<(20,trunc)%s %ad% an%d",
+	"oneline": "%h%d %s",
+	"short":   "%h %<(50,trunc)%s %<(16,trunc)%an %ar%d",
+	"full":    "%h %<(50,trunc)%s %<(20,trunc)%an <%ae> %ad %cr%d",
+}
+
+const DefaultTemplate = "default"
+
+// ParseTemplate reads a preset name or a format string. Unknown placeholders
+// and malformed width specifiers are errors, unlike in git which prints them.
+func ParseTemplate(format string) (*Template, error) {
+	if preset, exists := PRESETS[format]; exists {
+		format = preset
+	}
+	template := &Template{Source: format}
+	pending := segment{}
+	literal := strings.Builder{}
+	flush := func() {
+		if literal.Len() > 0 {
+			template.segments = append(template.segments, segment{placeholder: Literal, literal: literal.String()})
+			literal.Reset()
+		}
+	}
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			literal.WriteByte(format[i])
+			continue
+		}
+		rest := format[i+1:]
+		switch {
+		case rest == "":
+			return nil, fmt.Errorf("format %q: lone %% at the end", format)
+		case rest[0] == '%':
+			literal.WriteByte('%')
+			i++
+			continue
+		case rest[0] == 'n':
+			return nil, fmt.Errorf("format %q: %%n is not supported, commit lines are a single row", format)
+		case rest[0] == '<' || rest[0] == '>':
+			length, err := parseWidthSpec(rest, &pending)
+			if err != nil {
+				return nil, fmt.Errorf("format %q: %w", format, err)
+			}
+			i += length
+			continue
+		}
+
+		if rest[0] == ' ' {
+			pending.space_before = true
+			rest = rest[1:]
+			i++
+		}
+		found := false
+		for _, item := range placeholder_names {
+			if strings.HasPrefix(rest, item.name) {
+				flush()
+				pending.placeholder = item.placeholder
+				template.segments = append(template.segments, pending)
+				pending = segment{}
+				i += len(item.name)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("format %q: unknown placeholder %%%s", format, firstRune(rest))
+		}
+	}
+	if pending.align != AlignNone {
+		return nil, fmt.Errorf("format %q: width specifier without a placeholder after it", format)
+	}
+	flush()
+	return template, nil
+}
+
+func firstRune(s string) string {
+	_, size := utf8.DecodeRuneInString(s)
+	return s[:size]
+}
+
+// parseWidthSpec reads %<(N), %>(N), %><(N) and their %<|(N) column forms,
+// optionally followed by ",trunc", ",ltrunc" or ",mtrunc". It returns the
+// number of bytes read after the %.
+func parseWidthSpec(spec string, pending *segment) (int, error) {
+	open := strings.Index(spec, "(")
+	end := strings.Index(spec, ")")
+	if open < 0 || end < open {
+		return 0, fmt.Errorf("unterminated width specifier %%%s", spec)
+	}
+	switch strings.TrimSuffix(spec[:open], "|") {
+	case "<":
+		pending.align = AlignLeft
+	case ">":
+		pending.align = AlignRight
+	case "><":
+		pending.align = AlignCenter
+	default:
+		return 0, fmt.Errorf("unknown alignment %%%s", spec[:open])
+	}
+	pending.column = strings.HasSuffix(spec[:open], "|")
+
+	width_str, truncate_str, _ := strings.Cut(spec[open+1:end], ",")
+	width, err := strconv.Atoi(strings.TrimSpace(width_str))
+	if err != nil || width < 0 {
+		return 0, fmt.Errorf("invalid width %q", width_str)
+	}
+	pending.width = width
+	switch strings.TrimSpace(truncate_str) {
+	case "":
+		pending.truncate = NoTruncate
+	case "trunc":
+		pending.truncate = TruncateRight
+	case "ltrunc":
+		pending.truncate = TruncateLeft
+	case "mtrunc":
+		pending.truncate = TruncateMiddle
+	default:
+		return 0, fmt.Errorf("unknown truncation %q, expected trunc, ltrunc or mtrunc", truncate_str)
+	}
+	return end + 1, nil
+}
+
+// Format expands the template without colors.
+func (t *Template) Format(c *Commit) string {
+	return t.Expand(c, func(_ Placeholder, text string) string { return text })
+}
+
+// Expand formats the commit, calling paint on the text of every placeholder
+// after truncation and before padding, so escape codes do not count in widths.
+func (t *Template) Expand(c *Commit, paint func(Placeholder, string) string) string {
+	var result strings.Builder
+	column := 0
+	for _, s := range t.segments {
+		if s.placeholder == Literal {
+			result.WriteString(s.literal)
+			column += textWidth(s.literal)
+			continue
+		}
+		text := t.expandPlaceholder(c, s.placeholder)
+		if s.space_before && text != "" {
+			result.WriteString(" ")
+			column++
+		}
+		width := s.width
+		if s.column {
+			width = max(s.width-column, 0)
+		}
+		if s.align != AlignNone {
+			text = truncateText(text, width, s.truncate)
+		}
+		text_width := textWidth(text)
+		left, right := padding(text_width, width, s.align)
+		if text != "" {
+			text = paint(s.placeholder, text)
+		}
+		result.WriteString(strings.Repeat(" ", left) + text + strings.Repeat(" ", right))
+		column += left + text_width + right
+	}
+	return result.String()
+}
+
+func textWidth(s string) int {
+	return text_pkg.Width(s)
+}
+
+func truncateText(s string, width int, truncate Truncate) string {
+	switch truncate {
+	case TruncateRight:
+		return text_pkg.Truncate(s, width)
+	case TruncateLeft:
+		return text_pkg.TruncateLeft(s, width)
+	case TruncateMiddle:
+		return text_pkg.TruncateMiddle(s, width)
+	}
+	return s
+}
+
+func padding(text_width, width int, align Align) (int, int) {
+	missing := max(width-text_width, 0)
+	switch align {
+	case AlignLeft:
+		return 0, missing
+	case AlignRight:
+		return missing, 0
+	case AlignCenter:
+		return missing / 2, missing - missing/2
+	}
+	return 0, 0
+}
+
+func (t *Template) expandPlaceholder(c *Commit, placeholder Placeholder) string {
+	switch placeholder {
+	case HashFull:
+		return c.Hash
+	case HashShort:
+		return shortHash(c.Hash)
+	case ParentsFull:
+		return strings.Join(c.Parents, " ")
+	case ParentsShort:
+		parents := make([]string, len(c.Parents))
+		for i, parent_hash := range c.Parents {
+			parents[i] = shortHash(parent_hash)
+		}
+		return strings.Join(parents, " ")
+	case Subject:
+		return c.Message
+	case BodyText:
+		return strings.ReplaceAll(c.Body, "\n", " ")
+	case AuthorName:
+		return c.Author.Name
+	case AuthorEmail:
+		return c.Author.Email
+	case AuthorDate:
+		return t.Dates.Format(c.AuthorSignature())
+	case AuthorDateRelative:
+		return relativeDate(c.Timestamp, time.Now())
+	case AuthorDateUnix:
+		return strconv.FormatUint(c.Timestamp, 10)
+	case CommitterName:
+		return c.Committer.Name
+	case CommitterEmail:
+		return c.Committer.Email
+	case CommitterDate:
+		return t.Dates.Format(c.CommitterSignature())
+	case CommitterDateRelative:
+		return relativeDate(c.CommitterTimestamp(), time.Now())
+	case CommitterDateUnix:
+		return strconv.FormatUint(c.CommitterTimestamp(), 10)
+	case Decorations:
+		if len(c.Refs) == 0 {
+			return ""
+		}
+		return " (" + FormatRefs(c.Refs) + ")"
+	case DecorationsBare:
+		return FormatRefs(c.Refs)
+	}
+	return ""
+}
+
+func shortHash(hash string) string {
+	if len(hash) > short_hash_length {
+		return hash[:short_hash_length]
+	}
+	return hash
+}
@@ -0,0 +1,76 @@
+package commit
+
+import (
+	"testing"
+)
+
+func TestTemplateFormat(t *testing.T) {
+	c := &Commit{
+		Hash:      "0123456789abcdef0123456789abcdef01234567",
+		Message:   "a rather long subject line",
+		Timestamp: 0,
+		Author:    Signature{Name: "Ann", Email: "ann@example.org"},
+		Parents:   []string{"89abcdef0123456789abcdef0123456789abcdef"},
+		Refs:      ParseRefs("HEAD -> main, tag: v1"),
+	}
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{"%h %s", "01234567 a rather long subject line"},
+		{"%H", c.Hash},
+		{"%p|%an <%ae>|%%", "89abcdef|Ann <ann@example.org>|%"},
+		{"%h%d", "01234567 (HEAD -> main, tag: v1)"},
+		{"[%D]", "[HEAD -> main, tag: v1]"},
+		{"%<(10,trunc)%s|", "a rather …|"},
+		{"%<(10,ltrunc)%s|", "…ject line|"},
+		{"%<(10,mtrunc)%s|", "a ra… line|"},
+		{"%<(6)%an|", "Ann   |"},
+		{"%>(6)%an|", "   Ann|"},
+		{"%><(7)%an|", "  Ann  |"},
+		{"%an%<|(12)%ae|", "Annann@example.org|"},
+		{"%an%<|(8)%cn|", "Ann     |"},
+		{"%an% cn|% ae", "Ann| ann@example.org"},
+	}
+	wide := &Commit{Hash: c.Hash, Message: "修复渲染错误的问题"}
+	wide_tests := []struct {
+		format   string
+		expected string
+	}{
+		// Wide characters that do not fit are replaced by padding
+		{"%<(10,trunc)%s|", "修复渲染… |"},
+		{"%<(20)%s|", "修复渲染错误的问题  |"},
+	}
+	for _, test := range tests {
+		template, err := ParseTemplate(test.format)
+		if err != nil {
+			t.Errorf("ParseTemplate(%q): %v", test.format, err)
+			continue
+		}
+		if formatted := template.Format(c); formatted != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.format, test.expected, formatted)
+		}
+	}
+	for _, test := range wide_tests {
+		template, err := ParseTemplate(test.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if formatted := template.Format(wide); formatted != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.format, test.expected, formatted)
+		}
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	for _, format := range []string{"%q", "%h%n%s", "%<(abc)%s", "%<(10", "%<(10,cut)%s", "%s %<(10)", "%"} {
+		if _, err := ParseTemplate(format); err == nil {
+			t.Errorf("expected an error for %q", format)
+		}
+	}
+	for name := range PRESETS {
+		if _, err := ParseTemplate(name); err != nil {
+			t.Errorf("preset %s: %v", name, err)
+		}
+	}
+}
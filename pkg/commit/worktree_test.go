@@ -0,0 +1,56 @@
+package commit
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestWorktreeDecorations(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	main_dir := filepath.Join(dir, "main")
+	git := func(args ...string) {
+		t.Helper()
+		if output, err := exec.Command("git", append([]string{"-C", main_dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, output)
+		}
+	}
+	if output, err := exec.Command("git", "init", "-q", "-b", "main", main_dir).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, output)
+	}
+	git("commit", "-q", "--allow-empty", "-m", "first")
+	git("commit", "-q", "--allow-empty", "-m", "second")
+	git("worktree", "add", "-q", "-b", "feat", filepath.Join(dir, "wt-feat"))
+	git("worktree", "add", "-q", "--detach", filepath.Join(dir, "wt-detached"), "HEAD~1")
+
+	expected := map[string]map[string]string{
+		"main":    {"second": "HEAD -> main, worktree: wt-feat -> feat", "first": "worktree: wt-detached"},
+		"wt-feat": {"second": "HEAD -> feat, worktree: main -> main", "first": "worktree: wt-detached"},
+	}
+	for worktree, messages := range expected {
+		t.Run(worktree, func(t *testing.T) {
+			t.Chdir(filepath.Join(dir, worktree))
+			for _, source := range []CommitSource{NativeSource{Args: []string{"--all"}}, GitCLISource{Args: []string{"--all"}}} {
+				commits, err := source.Commits()
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, c := range commits {
+					if refs := FormatRefs(c.Refs); refs != messages[c.Message] {
+						t.Errorf("%T: %s has refs %q, expected %q", source, c.Message, refs, messages[c.Message])
+					}
+				}
+			}
+		})
+	}
+}
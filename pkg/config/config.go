@@ -0,0 +1,297 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+type LayoutConfig struct {
+	XSpacing int `toml:"x_spacing"`
+	YSpacing int `toml:"y_spacing"`
+	// Order of the rows: default, topo, date, author-date or lane-stable
+	Order string `toml:"order"`
+	// Lanes drawn at most, the others are folded into one. No limit when 0
+	MaxLanes int `toml:"max_lanes"`
+	// Reorder the lanes to cross fewer edges, never making the graph wider
+	ReduceCrossings bool `toml:"reduce_crossings"`
+}
+
+type RenderConfig struct {
+	Glyphs     string `toml:"glyphs"`
+	Color      string `toml:"color"`
+	ColorDepth string `toml:"color_depth"`
+	Theme      string `toml:"theme"`
+	Format     string `toml:"format"`
+	Date       string `toml:"date"`
+	Timezone   string `toml:"timezone"`
+}
+
+type TUIConfig struct {
+	Pager       bool `toml:"pager"`
+	ShowDetails bool `toml:"show_details"`
+}
+
+type LogConfig struct {
+	Level    string `toml:"level"`
+	Dir      string `toml:"dir"`
+	SaveJSON bool   `toml:"save_json"`
+}
+
+type GitConfig struct {
+	Backend string `toml:"backend"`
+	// Layouts are kept in .git/git-graph/ for the next run
+	Cache bool `toml:"cache"`
+}
+
+type Config struct {
+	Layout LayoutConfig `toml:"layout"`
+	Render RenderConfig `toml:"render"`
+	TUI    TUIConfig    `toml:"tui"`
+	Log    LogConfig    `toml:"log"`
+	Git    GitConfig    `toml:"git"`
+}
+
+func Default() Config {
+	return Config{
+		Layout: LayoutConfig{XSpacing: 4, YSpacing: 2, Order: "default", ReduceCrossings: true},
+		Render: RenderConfig{Glyphs: "rounded", Color: "auto", Theme: "dark", Format: "default", Date: "default", Timezone: "local"},
+		TUI:    TUIConfig{Pager: true, ShowDetails: true},
+		Log:    LogConfig{Level: "warn"},
+		Git:    GitConfig{Backend: "auto", Cache: true},
+	}
+}
+
+// Settings that can also be given as `git config graph.<key>` or as
+// environment variables, by their path in the config file.
+var git_config_keys = map[string]string{
+	"graph.xspacing":        "layout.x_spacing",
+	"graph.yspacing":        "layout.y_spacing",
+	"graph.order":           "layout.order",
+	"graph.maxlanes":        "layout.max_lanes",
+	"graph.reducecrossings": "layout.reduce_crossings",
+	"graph.glyphs":          "render.glyphs",
+	"graph.color":           "render.color",
+	"graph.colordepth":      "render.color_depth",
+	"graph.theme":           "render.theme",
+	"graph.format":          "render.format",
+	"graph.date":            "render.date",
+	"graph.timezone":        "render.timezone",
+	"graph.pager":           "tui.pager",
+	"graph.showdetails":     "tui.show_details",
+	"graph.loglevel":        "log.level",
+	"graph.backend":         "git.backend",
+	"graph.cache":           "git.cache",
+}
+
+var env_variables = map[string]string{
+	"GRAPH_GLYPHS":      "render.glyphs",
+	"GRAPH_COLOR":       "render.color",
+	"GRAPH_THEME":       "render.theme",
+	"GRAPH_FORMAT":      "render.format",
+	"GRAPH_LOG_LEVEL":   "log.level",
+	"GRAPH_LOG_DIR":     "log.dir",
+	"GRAPH_SAVE_JSON":   "log.save_json",
+	"GRAPH_GIT_BACKEND": "git.backend",
+	"GRAPH_CACHE":       "git.cache",
+}
+
+const repo_config_name = ".git-graph.toml"
+
+func UserConfigDir() string {
+	config_dir := os.Getenv("XDG_CONFIG_HOME")
+	if config_dir == "" {
+		config_dir = filepath.Join(os.Getenv("HOME"), ".config")
+	}
+	return filepath.Join(config_dir, "git-graph")
+}
+
+func UserConfigPath() string {
+	return filepath.Join(UserConfigDir(), "config.toml")
+}
+
+// Load builds the configuration from the defaults, the user config file, the
+// repository overrides (.git-graph.toml and `git config graph.*`) and the
+// environment, each layer overriding the previous ones. CLI flags are applied
+// on top by the caller with Set.
+func Load() (Config, error) {
+	cfg := Default()
+
+	if err := cfg.LoadFile(UserConfigPath()); err != nil {
+		return cfg, err
+	}
+	if path := findRepoConfig("."); path != "" {
+		if err := cfg.LoadFile(path); err != nil {
+			return cfg, err
+		}
+	}
+	if err := cfg.applyGitConfig(); err != nil {
+		return cfg, err
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// LoadFile decodes a TOML file on top of cfg, keys missing in the file keep
+// their current values. A missing file is not an error.
+func (cfg *Config) LoadFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	metadata, err := toml.Decode(string(content), cfg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+		return fmt.Errorf("%s: unknown option %s", path, undecoded[0])
+	}
+	return nil
+}
+
+// findRepoConfig looks for .git-graph.toml in the top directory of the
+// repository containing dir, or next to the .git directory given in GIT_DIR.
+func findRepoConfig(dir string) string {
+	if git_dir := os.Getenv("GIT_DIR"); git_dir != "" {
+		if filepath.Base(git_dir) != ".git" {
+			return ""
+		}
+		dir = filepath.Dir(git_dir)
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			path := filepath.Join(dir, repo_config_name)
+			if _, err := os.Stat(path); err == nil {
+				return path
+			}
+			return ""
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func (cfg *Config) applyGitConfig() error {
+	output, err := exec.Command("git", "config", "--get-regexp", `^graph\.`).Output()
+	if err != nil {
+		// No keys set, no repository or no git at all
+		return nil
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		path, exists := git_config_keys[strings.ToLower(key)]
+		if !exists {
+			continue
+		}
+		if err := cfg.Set(path, value); err != nil {
+			return fmt.Errorf("git config %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func (cfg *Config) applyEnv() error {
+	for name, path := range env_variables {
+		value, exists := os.LookupEnv(name)
+		if !exists || value == "" {
+			continue
+		}
+		if err := cfg.Set(path, value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Set assigns a value given as text to the option at path, e.g. "render.glyphs".
+func (cfg *Config) Set(path string, value string) error {
+	section_name, key, found := strings.Cut(path, ".")
+	if !found {
+		return fmt.Errorf("unknown option %s", path)
+	}
+	section, exists := fieldByTag(reflect.ValueOf(cfg).Elem(), section_name)
+	if !exists {
+		return fmt.Errorf("unknown option %s", path)
+	}
+	field, exists := fieldByTag(section, key)
+	if !exists {
+		return fmt.Errorf("unknown option %s", path)
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s expects a number, got %q", path, value)
+		}
+		field.SetInt(int64(number))
+	case reflect.Bool:
+		flag, err := parseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s expects true or false, got %q", path, value)
+		}
+		field.SetBool(flag)
+	}
+	return nil
+}
+
+func fieldByTag(value reflect.Value, tag string) (reflect.Value, bool) {
+	for i := range value.NumField() {
+		if value.Type().Field(i).Tag.Get("toml") == tag {
+			return value.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// parseBool also accepts the spellings git config uses for booleans.
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q", value)
+}
+
+func (cfg *Config) Validate() error {
+	if cfg.Layout.XSpacing < 2 || cfg.Layout.YSpacing < 2 {
+		return fmt.Errorf("layout.x_spacing and layout.y_spacing must be at least 2")
+	}
+	if cfg.Layout.MaxLanes < 0 || cfg.Layout.MaxLanes == 1 {
+		return fmt.Errorf("layout.max_lanes must be 0 for no limit or at least 2")
+	}
+	switch cfg.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("unknown log.level %q, expected one of: debug, info, warn, error", cfg.Log.Level)
+	}
+	switch cfg.Git.Backend {
+	case "auto", "native", "exec":
+	default:
+		return fmt.Errorf("unknown git.backend %q, expected one of: auto, native, exec", cfg.Git.Backend)
+	}
+	return nil
+}
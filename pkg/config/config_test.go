@@ -0,0 +1,135 @@
+package config
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadLayers(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_CONFIG_GLOBAL", "/dev/null")
+	for name := range env_variables {
+		t.Setenv(name, "")
+	}
+
+	writeFile(t, filepath.Join(home, ".config", "git-graph", "config.toml"), `
+[render]
+glyphs = "heavy"
+theme = "light"
+format = "short"
+
+[layout]
+x_spacing = 6
+`)
+
+	repo_dir := filepath.Join(home, "repo")
+	if output, err := exec.Command("git", "init", "-q", repo_dir).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, output)
+	}
+	writeFile(t, filepath.Join(repo_dir, ".git-graph.toml"), `
+[render]
+glyphs = "ascii"
+`)
+	if output, err := exec.Command("git", "-C", repo_dir, "config", "graph.format", "oneline").CombinedOutput(); err != nil {
+		t.Fatalf("git config: %v\n%s", err, output)
+	}
+	t.Setenv("GRAPH_THEME", "dark")
+
+	sub_dir := filepath.Join(repo_dir, "sub")
+	if err := os.Mkdir(sub_dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(sub_dir)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Default()
+	expected.Layout.XSpacing = 6
+	expected.Render.Glyphs = "ascii"
+	expected.Render.Format = "oneline"
+	expected.Render.Theme = "dark"
+	if cfg != expected {
+		t.Errorf("expected %+v, got %+v", expected, cfg)
+	}
+}
+
+func TestLoadInvalidEnvironment(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_CONFIG_GLOBAL", "/dev/null")
+	t.Setenv("GIT_CEILING_DIRECTORIES", home)
+	t.Chdir(home)
+	for name := range env_variables {
+		t.Setenv(name, "")
+	}
+
+	t.Setenv("GRAPH_GIT_BACKEND", "native")
+	if cfg, err := Load(); err != nil || cfg.Git.Backend != "native" {
+		t.Errorf("expected the native backend, got %q, %v", cfg.Git.Backend, err)
+	}
+	t.Setenv("GRAPH_GIT_BACKEND", "libgit2")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "git.backend") {
+		t.Errorf("expected an unknown git.backend error, got %v", err)
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	cfg := Default()
+	if err := cfg.LoadFile(filepath.Join(t.TempDir(), "missing.toml")); err != nil {
+		t.Errorf("a missing file should be ignored, got %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.toml")
+	writeFile(t, path, "[render]\nglyph = \"ascii\"\n")
+	if err := cfg.LoadFile(path); err == nil {
+		t.Error("expected an error for an unknown option")
+	}
+}
+
+func TestSet(t *testing.T) {
+	cfg := Default()
+	tests := []struct {
+		path  string
+		value string
+		valid bool
+	}{
+		{"render.glyphs", "heavy", true},
+		{"layout.y_spacing", "3", true},
+		{"tui.pager", "off", true},
+		{"layout.y_spacing", "three", false},
+		{"tui.pager", "maybe", false},
+		{"render.unknown", "x", false},
+		{"glyphs", "x", false},
+	}
+	for _, test := range tests {
+		if err := cfg.Set(test.path, test.value); (err == nil) != test.valid {
+			t.Errorf("Set(%q, %q) returned %v", test.path, test.value, err)
+		}
+	}
+	if cfg.Render.Glyphs != "heavy" || cfg.Layout.YSpacing != 3 || cfg.TUI.Pager {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+}
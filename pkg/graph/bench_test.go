@@ -0,0 +1,109 @@
+package graph
+
+import (
+	"fmt"
+	"maps"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// syntheticHistory builds a history of count commits shaped like a busy
+// repository: a main line with feature branches forking off, getting commits
+// and being merged back.
+func syntheticHistory(count int, max_branches int) map[string]Commit {
+	random := rand.New(rand.NewSource(1))
+	commits := make(map[string]Commit, count)
+	add := func(message string, parents ...string) string {
+		hash := fmt.Sprintf("%040x", len(commits)+1)
+		commits[hash] = Commit{
+			Hash:      hash,
+			Message:   message,
+			Timestamp: uint64(len(commits)+1) * 60,
+			Parents:   parents,
+			Y_pos:     count - len(commits),
+		}
+		return hash
+	}
+
+	main_tip := add("root")
+	branches := []string{}
+	for len(commits) < count {
+		switch choice := random.Intn(10); {
+		case choice < 3:
+			main_tip = add("main", main_tip)
+		case choice < 8 && len(branches) > 0:
+			i := random.Intn(len(branches))
+			branches[i] = add("work", branches[i])
+		case len(branches) > 0 && random.Intn(max_branches) < len(branches):
+			// Merges get more likely as branches pile up, about half of
+			// max_branches stay open
+			i := random.Intn(len(branches))
+			main_tip = add("merge", main_tip, branches[i])
+			branches = append(branches[:i], branches[i+1:]...)
+		default:
+			branches = append(branches, add("fork", main_tip))
+		}
+	}
+	return commits
+}
+
+func BenchmarkComputeLayout(b *testing.B) {
+	for _, size := range []struct {
+		name         string
+		count        int
+		max_branches int
+	}{
+		{"10k", 10_000, 16},
+		{"100k", 100_000, 16},
+		{"1M", 1_000_000, 16},
+		// Many lanes and long merge edges open at the same time
+		{"10k-wide", 10_000, 256},
+		{"100k-wide", 100_000, 256},
+	} {
+		b.Run(size.name, func(b *testing.B) {
+			if testing.Short() && size.count > 10_000 {
+				b.Skip("large histories are skipped in short mode")
+			}
+			commits := syntheticHistory(size.count, size.max_branches)
+			b.ResetTimer()
+			for range b.N {
+				ComputeLayout(&commits)
+			}
+		})
+	}
+}
+
+// BenchmarkLayoutStrategies compares the orders with and without crossing
+// reduction, reporting the crossings and lanes of the layout besides the time.
+func BenchmarkLayoutStrategies(b *testing.B) {
+	defer SetOrder(OrderDefault)
+	defer SetReduceCrossings(reduce_crossings)
+	names := slices.Sorted(maps.Keys(ORDERS))
+	for _, max_branches := range []int{16, 256} {
+		commits := syntheticHistory(10_000, max_branches)
+		for _, name := range names {
+			for _, reduce := range []bool{false, true} {
+				b.Run(fmt.Sprintf("%d-branches/%s/reduce=%t", max_branches, name, reduce), func(b *testing.B) {
+					SetOrder(ORDERS[name])
+					SetReduceCrossings(reduce)
+					var layout Layout
+					for range b.N {
+						layout = ComputeLayout(&commits)
+					}
+					b.ReportMetric(float64(CountCrossings(layout.Commits)), "crossings")
+					b.ReportMetric(float64(layout.MaxX+1), "lanes")
+				})
+			}
+		}
+	}
+}
+
+func BenchmarkProcessCommits(b *testing.B) {
+	commits := syntheticHistory(10_000, 16)
+	options := DefaultRenderOptions()
+	b.ResetTimer()
+	for range b.N {
+		ProcessCommits(&commits, options)
+	}
+}
@@ -0,0 +1,115 @@
+package graph
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Runs shorter than this are not worth a summary node
+const min_chain_length = 3
+
+// findChains returns the runs of commits with a single parent and a single
+// child, keyed by their newest commit, newest first. Merges, fork points,
+// branch tips and commits with refs end a run, as do parents outside the graph.
+func findChains(commits_map CommitsMap, children_map ChildrenMap) map[string][]string {
+	foldable := func(hash string) bool {
+		commit, exists := commits_map[hash]
+		if !exists || len(commit.Parents) != 1 || len(children_map[hash]) != 1 || len(commit.Refs) > 0 {
+			return false
+		}
+		_, parent_exists := commits_map[commit.Parents[0]]
+		return parent_exists && !strings.HasPrefix(hash, "dummy_")
+	}
+
+	chains := make(map[string][]string)
+	for hash := range commits_map {
+		// Runs are walked from their newest commit only
+		if !foldable(hash) || foldable(children_map[hash][0]) {
+			continue
+		}
+		chain := []string{}
+		for member := hash; foldable(member); member = commits_map[member].Parents[0] {
+			chain = append(chain, member)
+		}
+		if len(chain) >= min_chain_length {
+			chains[hash] = chain
+		}
+	}
+	return chains
+}
+
+// CompactChains folds every run found by findChains, except the ones in
+// expanded, into its newest commit. The node keeps that hash and generation
+// number, its message becomes "N commits" and its body lists them, and its
+// parent is the parent of the oldest commit of the run.
+func CompactChains(commits_map CommitsMap, children_map ChildrenMap, expanded map[string]bool) {
+	for top, chain := range findChains(commits_map, children_map) {
+		if expanded[top] {
+			continue
+		}
+		bottom := commits_map[chain[len(chain)-1]]
+		parent_hash := bottom.Parents[0]
+
+		lines := make([]string, len(chain))
+		for i, member := range chain {
+			lines[i] = shortHash(member) + " " + commits_map[member].Message
+		}
+		summary := commits_map[top]
+		summary.Message = fmt.Sprintf("%d commits", len(chain))
+		summary.Body = strings.Join(lines, "\n")
+		summary.Parents = []string{parent_hash}
+		summary.Collapsed = len(chain)
+		summary.Summary = true
+
+		for _, member := range chain[1:] {
+			delete(commits_map, member)
+			delete(children_map, member)
+		}
+		children := children_map[parent_hash]
+		children[slices.Index(children, bottom.Hash)] = top
+		slices.Sort(children)
+	}
+}
+
+// ChainView lays out a history with its long runs of commits folded, Toggle
+// shows the commits of a run and folds it again.
+type ChainView struct {
+	commits  map[string]Commit
+	options  RenderOptions
+	chains   map[string]string
+	expanded map[string]bool
+}
+
+func NewChainView(commits map[string]Commit, options RenderOptions) *ChainView {
+	v := &ChainView{
+		commits:  commits,
+		options:  options,
+		chains:   make(map[string]string),
+		expanded: make(map[string]bool),
+	}
+	commits_map := ComputeCommitsMap(&commits)
+	for top, chain := range findChains(commits_map, ComputeChildrenMap(&commits)) {
+		for _, member := range chain {
+			v.chains[member] = top
+		}
+	}
+	return v
+}
+
+// Toggle expands the run folded into hash, or folds the run hash is part of.
+// It returns the newest commit of the run, empty when hash is in none.
+func (v *ChainView) Toggle(hash string) string {
+	top, exists := v.chains[hash]
+	if !exists {
+		return ""
+	}
+	v.expanded[top] = !v.expanded[top]
+	return top
+}
+
+// Lines lays out and draws the commits with the runs not expanded folded.
+func (v *ChainView) Lines() []Line {
+	layout := ComputeCompactLayout(&v.commits, v.expanded)
+	return DrawGraphLines(layout.Commits, layout.MaxX, layout.MaxY, v.options)
+}
@@ -0,0 +1,84 @@
+package graph
+
+import (
+	"fmt"
+	"testing"
+
+	color "git-graph/pkg/color"
+	commit_pkg "git-graph/pkg/commit"
+)
+
+func TestCompactChains(t *testing.T) {
+	// c01 - ... - c10 (tag) - c11 - c12 - c13 - c14 (main)
+	//         \
+	//          b1 - b2 (topic)
+	builder := commit_pkg.NewBuilder().Add("c01xxxxx", "c01")
+	for i := 2; i <= 14; i++ {
+		builder.Add(fmt.Sprintf("c%02dxxxxx", i), fmt.Sprintf("c%02d", i), fmt.Sprintf("c%02dxxxxx", i-1))
+	}
+	builder.Add("b1xxxxxx", "b1", "c03xxxxx").Add("b2xxxxxx", "b2", "b1xxxxxx")
+	builder.Refs("c10xxxxx", "tag: v1").Refs("c14xxxxx", "HEAD -> main").Refs("b2xxxxxx", "topic")
+	commits, err := builder.Commits()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layout := ComputeCompactLayout(&commits, nil)
+	// c01, c02 and b1 alone are too short, c04-c09 and c11-c13 are folded
+	expected := map[string]int{
+		"c01xxxxx": 0, "c02xxxxx": 0, "c03xxxxx": 0, "c09xxxxx": 6, "c10xxxxx": 0,
+		"c13xxxxx": 3, "c14xxxxx": 0, "b1xxxxxx": 0, "b2xxxxxx": 0,
+	}
+	if len(layout.Commits) != len(expected) || layout.MaxY != len(expected) {
+		t.Fatalf("expected %d commits, got %d with MaxY %d", len(expected), len(layout.Commits), layout.MaxY)
+	}
+	for hash, collapsed := range expected {
+		commit, exists := layout.Commits[hash]
+		if !exists {
+			t.Errorf("%s should be shown", hash)
+			continue
+		}
+		if commit.Collapsed != collapsed || commit.Summary != (collapsed > 0) {
+			t.Errorf("%s: expected %d folded commits, got %d", hash, collapsed, commit.Collapsed)
+		}
+	}
+	if summary := layout.Commits["c09xxxxx"]; summary.Message != "6 commits" || summary.Parents[0] != "c03xxxxx" {
+		t.Errorf("unexpected summary %q with parents %v", summary.Message, summary.Parents)
+	}
+	if violations := Validate(layout.Commits); len(violations) > 0 {
+		t.Errorf("layout violations: %v", violations)
+	}
+	if len(commits["c09xxxxx"].Parents) != 1 || commits["c09xxxxx"].Parents[0] != "c08xxxxx" {
+		t.Error("the caller's commits should not be changed")
+	}
+
+	options := DefaultRenderOptions()
+	options.Color = color.NoColor
+	view := NewChainView(commits, options)
+	if toggled := view.Toggle("c14xxxxx"); toggled != "" {
+		t.Errorf("a branch tip should not toggle, got %s", toggled)
+	}
+	if toggled := view.Toggle("c09xxxxx"); toggled != "c09xxxxx" {
+		t.Fatalf("expected the chain of c09 to expand, got %q", toggled)
+	}
+	if shown := countCommits(view.Lines()); shown != len(expected)+5 {
+		t.Errorf("expected %d commits once expanded, got %d", len(expected)+5, shown)
+	}
+	// Any commit of an expanded chain folds it again
+	if toggled := view.Toggle("c05xxxxx"); toggled != "c09xxxxx" {
+		t.Errorf("expected the chain of c05 to fold, got %q", toggled)
+	}
+	if shown := countCommits(view.Lines()); shown != len(expected) {
+		t.Errorf("expected %d commits once folded, got %d", len(expected), shown)
+	}
+}
+
+func countCommits(lines []Line) int {
+	count := 0
+	for _, line := range lines {
+		if line.Hash != "" {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,481 @@
+package graph
+
+import (
+	"container/heap"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// Barycenter passes tried at most, each starts from the previous result
+const crossing_passes = 4
+
+// Whether layouts computed afterwards go through ReduceCrossings
+var reduce_crossings = true
+
+func SetReduceCrossings(enabled bool) {
+	layout_mutex.Lock()
+	defer layout_mutex.Unlock()
+	reduce_crossings = enabled
+}
+
+// CountCrossings returns the number of cells drawn with CROSS_CONNECTOR
+// because the horizontal part of an edge goes across a lane, drawn above and
+// below it by the vertical parts of other edges. Horizontals sharing a row,
+// and verticals sharing a column, are drawn as one line, so every cell counts
+// once. Junctions, where lines end on a lane from both sides as under merges
+// with parents on both sides, are drawn the same but are not crossings.
+func CountCrossings(commits_map CommitsMap) int {
+	// A vertical from top to bottom draws the lane above the rows after its
+	// top and below the rows before its bottom
+	type laneEvent struct{ row, x, above, below int }
+	events := []laneEvent{}
+	horizontals := []edgeSpan{}
+	for _, span := range edgeSpans(commits_map) {
+		if span.top < span.bottom {
+			x := span.owner.X_pos
+			events = append(events,
+				laneEvent{span.top, x, 0, 1}, laneEvent{span.top + 1, x, 1, 0},
+				laneEvent{span.bottom, x, 0, -1}, laneEvent{span.bottom + 1, x, -1, 0})
+		}
+		if span.turn != no_turn {
+			horizontals = append(horizontals, span)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].row < events[j].row })
+	sort.Slice(horizontals, func(i, j int) bool { return horizontals[i].turn < horizontals[j].turn })
+
+	// The tree has the columns with the lane drawn both above and below the
+	// row of the sweep
+	size := maxLane(commits_map) + 1
+	above, below := make([]int, size), make([]int, size)
+	drawn := newFenwickTree(size)
+	crossings, next := 0, 0
+	for start := 0; start < len(horizontals); {
+		row := horizontals[start].turn
+		for ; next < len(events) && events[next].row <= row; next++ {
+			e := events[next]
+			was_drawn := above[e.x] > 0 && below[e.x] > 0
+			above[e.x] += e.above
+			below[e.x] += e.below
+			if is_drawn := above[e.x] > 0 && below[e.x] > 0; is_drawn != was_drawn {
+				if is_drawn {
+					drawn.add(e.x, 1)
+				} else {
+					drawn.add(e.x, -1)
+				}
+			}
+		}
+
+		// Columns strictly between the ends of the horizontals of the row
+		inside := [][2]int{}
+		for ; start < len(horizontals) && horizontals[start].turn == row; start++ {
+			horizontal := horizontals[start]
+			left, right := min(horizontal.commit.X_pos, horizontal.parent.X_pos), max(horizontal.commit.X_pos, horizontal.parent.X_pos)
+			if right-left > 1 {
+				inside = append(inside, [2]int{left + 1, right - 1})
+			}
+		}
+		sort.Slice(inside, func(i, j int) bool { return inside[i][0] < inside[j][0] })
+		counted := -1
+		for _, columns := range inside {
+			if from := max(columns[0], counted+1); from <= columns[1] {
+				crossings += drawn.sum(columns[1]) - drawn.sum(from-1)
+			}
+			counted = max(counted, columns[1])
+		}
+	}
+	return crossings
+}
+
+// ReduceCrossings reorders the columns with sweepUnits, then with the
+// barycenter and median heuristics: units are placed left to right by the
+// average, or median, column of the units they have edges to, and finally
+// transposes neighbouring units. The two ends of every edge keep
+// their sides, so edges are drawn the same way. Each pass keeps the order
+// with the fewest crossings, if it has fewer than before and the graph is
+// not wider. It returns the largest X_pos.
+func ReduceCrossings(commits_map CommitsMap) int {
+	max_x := maxLane(commits_map)
+	if len(commits_map) == 0 {
+		return max_x
+	}
+	spans := edgeSpans(commits_map)
+	units, unit_of, rows := laneUnits(commits_map, spans)
+
+	// An edge keeps the unit of its left end before the one of its right end
+	neighbours := make([][]int, len(units))
+	after := make([][]int, len(units))
+	for _, span := range spans {
+		from, to := unit_of[span.commit.Hash], unit_of[span.parent.Hash]
+		if from == to {
+			continue
+		}
+		neighbours[from] = append(neighbours[from], to)
+		neighbours[to] = append(neighbours[to], from)
+		if span.commit.X_pos > span.parent.X_pos {
+			from, to = to, from
+		}
+		after[from] = append(after[from], to)
+	}
+
+	best := CountCrossings(commits_map)
+	if best == 0 {
+		return max_x
+	}
+	columns := make([]int, len(units))
+	for i, unit := range units {
+		columns[i] = unit.x
+	}
+	lines, linked := newUnitLines(units, spans, unit_of)
+	if swept, ok := sweepUnits(units, lines, linked, max_x); ok {
+		moveUnits(units, swept)
+		if crossings := CountCrossings(commits_map); crossings < best {
+			best, columns = crossings, swept
+			logger.Debug(fmt.Sprintf("crossing reduction sweep: %d crossings", best))
+		}
+		moveUnits(units, columns)
+	}
+	best_columns, best_max_x := columns, max_x
+	for range crossing_passes {
+		if best == 0 {
+			break
+		}
+		improved := false
+		for _, heuristic := range []func([]int) float64{barycenter, median} {
+			positions := make([]float64, len(units))
+			for i := range units {
+				positions[i] = float64(columns[i])
+				if len(neighbours[i]) == 0 {
+					continue
+				}
+				neighbour_columns := make([]int, len(neighbours[i]))
+				for j, neighbour := range neighbours[i] {
+					neighbour_columns[j] = columns[neighbour]
+				}
+				positions[i] = heuristic(neighbour_columns)
+			}
+			order := orderUnits(after, positions, columns)
+			new_columns, new_max_x := placeUnits(units, order, rows)
+			if new_max_x > max_x {
+				continue
+			}
+			moveUnits(units, new_columns)
+			crossings := CountCrossings(commits_map)
+			moveUnits(units, columns)
+			if crossings < best {
+				best, best_columns, best_max_x, improved = crossings, new_columns, new_max_x, true
+			}
+		}
+		if !improved {
+			break
+		}
+		logger.Debug(fmt.Sprintf("crossing reduction pass: %d crossings", best))
+		columns, max_x = best_columns, best_max_x
+		moveUnits(units, columns)
+	}
+	if best > 0 {
+		swaps := transposeUnits(units, lines, linked, columns, max_x)
+		logger.Debug(fmt.Sprintf("crossing reduction: %d units swapped", swaps))
+		moveUnits(units, columns)
+	}
+	return maxLane(commits_map)
+}
+
+// unitLines are the parts of the edges of a unit crossings depend on: the
+// half rows its verticals are strictly inside, merged, and the rows its edges
+// turn on with the side their other end is on.
+type unitLines struct {
+	verticals [][2]int
+	turns     []unitTurn
+}
+
+type unitTurn struct {
+	row   int
+	right bool
+}
+
+func (l *unitLines) active(row int) bool {
+	i := sort.Search(len(l.verticals), func(i int) bool { return l.verticals[i][0] >= row })
+	return i > 0 && row < l.verticals[i-1][1]
+}
+
+// crossed counts the turns of l between rows top and bottom going to the
+// given side where other has a vertical.
+func (l *unitLines) crossed(other *unitLines, top, bottom int, right bool) int {
+	count := 0
+	i := sort.Search(len(l.turns), func(i int) bool { return l.turns[i].row >= top })
+	for ; i < len(l.turns) && l.turns[i].row <= bottom; i++ {
+		if l.turns[i].right == right && other.active(l.turns[i].row) {
+			count++
+		}
+	}
+	return count
+}
+
+// newUnitLines returns the lines of every unit, and for every pair of units
+// joined by an edge the one on the left.
+func newUnitLines(units []*laneUnit, spans []edgeSpan, unit_of map[string]int) ([]unitLines, map[[2]int]int) {
+	lines := make([]unitLines, len(units))
+	linked := make(map[[2]int]int)
+	for _, span := range spans {
+		if span.top+1 < span.bottom {
+			owner := &lines[unit_of[span.owner.Hash]]
+			owner.verticals = append(owner.verticals, [2]int{span.top, span.bottom})
+		}
+		from, to := unit_of[span.commit.Hash], unit_of[span.parent.Hash]
+		if from == to {
+			continue
+		}
+		left := from
+		if span.parent.X_pos < span.commit.X_pos {
+			left = to
+		}
+		linked[[2]int{min(from, to), max(from, to)}] = left
+		if span.turn != no_turn {
+			right := span.parent.X_pos > span.commit.X_pos
+			lines[from].turns = append(lines[from].turns, unitTurn{span.turn, right})
+			lines[to].turns = append(lines[to].turns, unitTurn{span.turn, !right})
+		}
+	}
+	for i := range lines {
+		verticals := lines[i].verticals
+		sort.Slice(verticals, func(a, b int) bool { return verticals[a][0] < verticals[b][0] })
+		merged := verticals[:0]
+		for _, vertical := range verticals {
+			if last := len(merged) - 1; last >= 0 && vertical[0] < merged[last][1] {
+				merged[last][1] = max(merged[last][1], vertical[1])
+				continue
+			}
+			merged = append(merged, vertical)
+		}
+		lines[i].verticals = merged
+		turns := lines[i].turns
+		sort.Slice(turns, func(a, b int) bool { return turns[a].row < turns[b].row })
+	}
+	return lines, linked
+}
+
+// crossingsBetween counts the crossings between units u and v on the half
+// rows both are on, with u left of v.
+func crossingsBetween(units []*laneUnit, lines []unitLines, u, v int) int {
+	top, bottom := max(units[u].top, units[v].top), min(units[u].bottom, units[v].bottom)
+	return lines[u].crossed(&lines[v], top, bottom, true) + lines[v].crossed(&lines[u], top, bottom, false)
+}
+
+// sweepUnits places the units again from the top, each in the free column
+// where it crosses the fewest of the units already on its half rows. On ties
+// a unit that no edge keeps left of another takes the rightmost free column,
+// leaving the ones on the left to the shorter units starting on its rows,
+// which then do not cross it, and the others the leftmost. The edges keep
+// their sides and columns past max_x are not used, it returns false when a
+// unit has no column left.
+func sweepUnits(units []*laneUnit, lines []unitLines, linked map[[2]int]int, max_x int) ([]int, bool) {
+	order := make([]int, len(units))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool {
+		if units[order[a]].top != units[order[b]].top {
+			return units[order[a]].top < units[order[b]].top
+		}
+		return units[order[a]].x < units[order[b]].x
+	})
+	keeps_left := make([]bool, len(units))
+	for _, left := range linked {
+		keeps_left[left] = true
+	}
+
+	columns := make([]int, len(units))
+	// The last unit placed in each column, -1 for none
+	placed := make([]int, max_x+1)
+	for x := range placed {
+		placed[x] = -1
+	}
+	// Added to the crossings of the columns from x on
+	delta := make([]int, max_x+2)
+	for _, u := range order {
+		clear(delta)
+		low, high := 0, max_x
+		for x, v := range placed {
+			if v < 0 || units[v].bottom < units[u].top {
+				continue
+			}
+			if left, exists := linked[[2]int{min(u, v), max(u, v)}]; exists {
+				if left == v {
+					low = max(low, x+1)
+				} else {
+					high = min(high, x-1)
+				}
+			}
+			// Left of v in the columns before x, right of it after
+			left_of_v, right_of_v := crossingsBetween(units, lines, u, v), crossingsBetween(units, lines, v, u)
+			delta[0] += left_of_v
+			delta[x] -= left_of_v
+			delta[x+1] += right_of_v
+		}
+		best, best_crossings, crossings := -1, 0, 0
+		for x := 0; x <= max_x; x++ {
+			crossings += delta[x]
+			if v := placed[x]; x < low || x > high || v >= 0 && units[v].bottom >= units[u].top {
+				continue
+			}
+			if best < 0 || crossings < best_crossings || crossings == best_crossings && !keeps_left[u] {
+				best, best_crossings = x, crossings
+			}
+		}
+		if best < 0 {
+			return nil, false
+		}
+		columns[u] = best
+		placed[best] = u
+	}
+	return columns, true
+}
+
+// transposeUnits swaps units in neighbouring columns while it removes
+// crossings. Only units alone on each other's rows in the other column swap,
+// and never the two ends of an edge, so the width and the sides of the edges
+// stay the same and only the crossings between the two change. It updates
+// columns and returns the number of swaps.
+func transposeUnits(units []*laneUnit, lines []unitLines, linked map[[2]int]int, columns []int, max_x int) int {
+	by_column := make([][]int, max_x+1)
+	for i := range units {
+		by_column[columns[i]] = append(by_column[columns[i]], i)
+	}
+	for _, column := range by_column {
+		sort.Slice(column, func(a, b int) bool { return units[column[a]].top < units[column[b]].top })
+	}
+
+	swaps := 0
+	for range crossing_passes {
+		swapped := false
+		for x := 0; x < max_x; x++ {
+			left, right := by_column[x], by_column[x+1]
+			for i, u := range left {
+				// v is the only unit right of u on its rows, and u the only one
+				// left of v on the rows of v
+				j := sort.Search(len(right), func(j int) bool { return units[right[j]].bottom >= units[u].top })
+				if j == len(right) || units[right[j]].top > units[u].bottom {
+					continue
+				}
+				v := right[j]
+				if j+1 < len(right) && units[right[j+1]].top <= units[u].bottom {
+					continue
+				}
+				if i > 0 && units[left[i-1]].bottom >= units[v].top || i+1 < len(left) && units[left[i+1]].top <= units[v].bottom {
+					continue
+				}
+				if _, exists := linked[[2]int{min(u, v), max(u, v)}]; exists {
+					continue
+				}
+				if crossingsBetween(units, lines, v, u) >= crossingsBetween(units, lines, u, v) {
+					continue
+				}
+				left[i], right[j] = v, u
+				columns[u], columns[v] = x+1, x
+				swaps++
+				swapped = true
+			}
+		}
+		if !swapped {
+			break
+		}
+	}
+	return swaps
+}
+
+func barycenter(columns []int) float64 {
+	sum := 0
+	for _, x := range columns {
+		sum += x
+	}
+	return float64(sum) / float64(len(columns))
+}
+
+// median averages the two middle columns of an even count
+func median(columns []int) float64 {
+	slices.Sort(columns)
+	middle := len(columns) / 2
+	if len(columns)%2 == 0 {
+		return float64(columns[middle-1]+columns[middle]) / 2
+	}
+	return float64(columns[middle])
+}
+
+// orderUnits sorts the units by barycenter, then by column, a unit coming
+// only after the ones it has to be right of.
+func orderUnits(after [][]int, barycenters []float64, columns []int) []int {
+	before_count := make([]int, len(after))
+	for _, units := range after {
+		for _, unit := range units {
+			before_count[unit]++
+		}
+	}
+	ready := &unitQueue{barycenters: barycenters, columns: columns}
+	for unit, count := range before_count {
+		if count == 0 {
+			ready.units = append(ready.units, unit)
+		}
+	}
+	heap.Init(ready)
+	order := make([]int, 0, len(after))
+	for ready.Len() > 0 {
+		unit := heap.Pop(ready).(int)
+		order = append(order, unit)
+		for _, next := range after[unit] {
+			before_count[next]--
+			if before_count[next] == 0 {
+				heap.Push(ready, next)
+			}
+		}
+	}
+	return order
+}
+
+type unitQueue struct {
+	units       []int
+	barycenters []float64
+	columns     []int
+}
+
+func (q unitQueue) Len() int { return len(q.units) }
+func (q unitQueue) Less(i, j int) bool {
+	a, b := q.units[i], q.units[j]
+	if q.barycenters[a] != q.barycenters[b] {
+		return q.barycenters[a] < q.barycenters[b]
+	}
+	if q.columns[a] != q.columns[b] {
+		return q.columns[a] < q.columns[b]
+	}
+	return a < b
+}
+func (q unitQueue) Swap(i, j int) { q.units[i], q.units[j] = q.units[j], q.units[i] }
+func (q *unitQueue) Push(x any)   { q.units = append(q.units, x.(int)) }
+func (q *unitQueue) Pop() any {
+	last := q.units[len(q.units)-1]
+	q.units = q.units[:len(q.units)-1]
+	return last
+}
+
+// fenwickTree counts the columns with a vertical.
+type fenwickTree []int
+
+func newFenwickTree(size int) fenwickTree {
+	return make(fenwickTree, size+1)
+}
+
+func (f fenwickTree) add(x, delta int) {
+	for i := x + 1; i < len(f); i += i & -i {
+		f[i] += delta
+	}
+}
+
+// sum counts the columns up to x included.
+func (f fenwickTree) sum(x int) int {
+	total := 0
+	for i := x + 1; i > 0; i -= i & -i {
+		total += f[i]
+	}
+	return total
+}
@@ -0,0 +1,132 @@
+package graph
+
+import (
+	"testing"
+
+	color "git-graph/pkg/color"
+)
+
+// drawnCrossings counts the CROSS_CONNECTOR cells of a drawn layout that an
+// edge goes across, the others are junctions where lines only meet.
+func drawnCrossings(layout Layout) int {
+	options := DefaultRenderOptions()
+	options.Color = color.NoColor
+	across := make(map[[2]int]bool)
+	for _, span := range edgeSpans(layout.Commits) {
+		for x := min(span.commit.X_pos, span.parent.X_pos) + 1; x < max(span.commit.X_pos, span.parent.X_pos); x++ {
+			across[[2]int{span.turn, x * options.XSpacing}] = true
+		}
+	}
+	crossings := 0
+	for y, line := range DrawGraphLines(layout.Commits, layout.MaxX, layout.MaxY, options) {
+		for x, glyph := range []rune(line.Graph) {
+			if string(glyph) == options.Glyphs[CROSS_CONNECTOR] && across[[2]int{y, x}] {
+				crossings++
+			}
+		}
+	}
+	return crossings
+}
+
+// CountCrossings counts the crossings drawn
+func TestCountCrossingsDrawn(t *testing.T) {
+	eachLayout(t, func(name string, layout Layout) {
+		if counted, drawn := CountCrossings(layout.Commits), drawnCrossings(layout); counted != drawn {
+			t.Errorf("%s: %d crossings counted, %d drawn", name, counted, drawn)
+		}
+	})
+}
+
+func TestReduceCrossings(t *testing.T) {
+	// The edge from a turns right to c across the lane of z and w
+	commits_map := CommitsMap{
+		"zzzzzzzz": {Hash: "zzzzzzzz", Parents: []string{"wwwwwwww"}, X_pos: 1, Y_pos: 0},
+		"aaaaaaaa": {Hash: "aaaaaaaa", Parents: []string{"cccccccc"}, X_pos: 0, Y_pos: 1},
+		"cccccccc": {Hash: "cccccccc", X_pos: 2, Y_pos: 2},
+		"wwwwwwww": {Hash: "wwwwwwww", X_pos: 1, Y_pos: 3},
+	}
+	if crossings := CountCrossings(commits_map); crossings != 1 {
+		t.Fatalf("expected 1 crossing, got %d", crossings)
+	}
+
+	if max_x := ReduceCrossings(commits_map); max_x != 2 {
+		t.Errorf("expected 3 lanes, got %d", max_x+1)
+	}
+	if crossings := CountCrossings(commits_map); crossings != 0 {
+		t.Errorf("expected no crossing, got %d", crossings)
+	}
+	if commits_map["aaaaaaaa"].X_pos >= commits_map["cccccccc"].X_pos {
+		t.Errorf("expected c still right of a")
+	}
+	if violations := Validate(commits_map); len(violations) > 0 {
+		t.Errorf("layout violations: %v", violations)
+	}
+}
+
+// In date order the edge from the octopus merge to b5 comes down left of the
+// lane of b4 and turns right across it, the pass moves b4 to the left
+func TestReduceCrossingsOctopus(t *testing.T) {
+	commits := loadFixture(t, "canonical-octopus")
+	defer SetOrder(OrderDefault)
+	defer SetReduceCrossings(reduce_crossings)
+	SetOrder(OrderDate)
+	SetReduceCrossings(false)
+	before := ComputeLayout(&commits)
+	SetReduceCrossings(true)
+	after := ComputeLayout(&commits)
+
+	if counted, drawn := CountCrossings(before.Commits), drawnCrossings(before); counted != 1 || drawn != 1 {
+		t.Errorf("expected 1 crossing before, got %d counted and %d drawn", counted, drawn)
+	}
+	if counted, drawn := CountCrossings(after.Commits), drawnCrossings(after); counted != 0 || drawn != 0 {
+		t.Errorf("expected no crossing after, got %d counted and %d drawn", counted, drawn)
+	}
+	if after.MaxX != before.MaxX {
+		t.Errorf("expected %d lanes, got %d", before.MaxX+1, after.MaxX+1)
+	}
+}
+
+// Reducing crossings never adds any, nor lanes or violations
+func TestReduceCrossingsFixtures(t *testing.T) {
+	defer SetReduceCrossings(reduce_crossings)
+	for _, s := range synthetic_scenarios {
+		commits := loadFixture(t, s.name)
+		SetReduceCrossings(false)
+		before := ComputeLayout(&commits)
+		SetReduceCrossings(true)
+		after := ComputeLayout(&commits)
+
+		if CountCrossings(after.Commits) > CountCrossings(before.Commits) {
+			t.Errorf("%s: %d crossings instead of %d", s.name, CountCrossings(after.Commits), CountCrossings(before.Commits))
+		}
+		if after.MaxX > before.MaxX {
+			t.Errorf("%s: %d lanes instead of %d", s.name, after.MaxX+1, before.MaxX+1)
+		}
+		if len(Validate(after.Commits)) > len(Validate(before.Commits)) {
+			t.Errorf("%s: new layout violations: %v", s.name, Validate(after.Commits))
+		}
+	}
+}
+
+// Branches forking from and merging into the main lane while others are open
+// cross them less once the sweep leaves the columns left of long branches to
+// the shorter ones: at least a quarter of the crossings go, in every order
+func TestReduceCrossingsSynthetic(t *testing.T) {
+	commits := syntheticHistory(300, 16)
+	defer SetOrder(layout_order)
+	defer SetReduceCrossings(reduce_crossings)
+	for name, order := range ORDERS {
+		SetOrder(order)
+		SetReduceCrossings(false)
+		before := ComputeLayout(&commits)
+		SetReduceCrossings(true)
+		after := ComputeLayout(&commits)
+
+		if crossings_before, crossings_after := CountCrossings(before.Commits), CountCrossings(after.Commits); 4*crossings_after > 3*crossings_before {
+			t.Errorf("%s order: %d crossings instead of %d", name, crossings_after, crossings_before)
+		}
+		if after.MaxX != before.MaxX {
+			t.Errorf("%s order: %d lanes instead of %d", name, after.MaxX+1, before.MaxX+1)
+		}
+	}
+}
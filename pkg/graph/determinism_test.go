@@ -0,0 +1,61 @@
+package graph
+
+import (
+	"maps"
+	"math/rand"
+	"testing"
+)
+
+// shuffled copies commits into a new map, inserting them in a random order.
+func shuffled(commits map[string]Commit, random *rand.Rand) map[string]Commit {
+	hashes := make([]string, 0, len(commits))
+	for hash := range commits {
+		hashes = append(hashes, hash)
+	}
+	random.Shuffle(len(hashes), func(i, j int) { hashes[i], hashes[j] = hashes[j], hashes[i] })
+	copied := make(map[string]Commit, len(commits))
+	for _, hash := range hashes {
+		copied[hash] = commits[hash]
+	}
+	return copied
+}
+
+func positions(layout Layout) map[string][2]int {
+	result := make(map[string][2]int, len(layout.Commits))
+	for hash, commit := range layout.Commits {
+		result[hash] = [2]int{commit.X_pos, commit.Y_pos}
+	}
+	return result
+}
+
+// The same commits get the same layout whatever the order of the map
+func TestLayoutDeterministic(t *testing.T) {
+	histories := layoutHistories(t)
+	histories["synthetic"] = syntheticHistory(500, 16)
+	// Without dates only the documented tie-breaking orders the rows
+	same_dates := syntheticHistory(500, 16)
+	for hash, commit := range same_dates {
+		commit.Timestamp = 0
+		same_dates[hash] = commit
+	}
+	histories["same-dates"] = same_dates
+
+	defer SetOrder(OrderDefault)
+	random := rand.New(rand.NewSource(1))
+	for name, commits := range histories {
+		for order_name, order := range ORDERS {
+			SetOrder(order)
+			expected := ComputeLayout(&commits)
+			for run := range 5 {
+				copied := shuffled(commits, random)
+				layout := ComputeLayout(&copied)
+				if layout.MaxX != expected.MaxX || layout.MaxY != expected.MaxY {
+					t.Fatalf("%s, %s order, run %d: size %dx%d instead of %dx%d", name, order_name, run, layout.MaxX, layout.MaxY, expected.MaxX, expected.MaxY)
+				}
+				if !maps.Equal(positions(layout), positions(expected)) {
+					t.Fatalf("%s, %s order, run %d: positions differ", name, order_name, run)
+				}
+			}
+		}
+	}
+}
@@ -3,55 +3,241 @@ package graph
 import (
 	"fmt"
 	"strings"
+
+	color "git-graph/pkg/color"
+	commit_pkg "git-graph/pkg/commit"
+	theme "git-graph/pkg/theme"
 )
 
+type Glyph int
+
 const (
-	VERTICAL          = "│"
-	HORIZONTAL        = "─"
-	DOWN_RIGHT_CORNER = "╯"
-	UP_RIGTH_CORNER   = "╮"
-	UP_LEFT_CORNER    = "╭"
-	COMMIT            = "●"
-	MERGE_COMMIT      = "○"
-	T_DOWN_CONNECTOR  = "┬"
-	T_UP_CONNECTOR    = "┴"
-	T_LEFT_CONNECTOR  = "├"
-	T_RIGHT_CONNECTOR = "┤"
-	CROSS_CONNECTOR   = "┼"
+	BLANK Glyph = iota
+	VERTICAL
+	HORIZONTAL
+	DOWN_RIGHT_CORNER
+	UP_RIGTH_CORNER
+	UP_LEFT_CORNER
+	COMMIT
+	MERGE_COMMIT
+	T_DOWN_CONNECTOR
+	T_UP_CONNECTOR
+	T_LEFT_CONNECTOR
+	T_RIGHT_CONNECTOR
+	CROSS_CONNECTOR
+	COLLAPSED_MERGE
+	COLLAPSED_CHAIN
+	OVERFLOW
+	glyph_count
 )
 
-var COLLORS_PALLETE = []string{
-	"\033[38;2;255;182;193m",
-	"\033[38;2;173;216;230m",
-	"\033[38;2;255;223;170m",
-	"\033[38;2;199;214;189m",
-	"\033[38;2;188;143;143m",
-	"\033[38;2;221;160;221m",
+type GlyphSet [glyph_count]string
+
+var ROUNDED_GLYPHS = GlyphSet{
+	BLANK:             " ",
+	VERTICAL:          "│",
+	HORIZONTAL:        "─",
+	DOWN_RIGHT_CORNER: "╯",
+	UP_RIGTH_CORNER:   "╮",
+	UP_LEFT_CORNER:    "╭",
+	COMMIT:            "●",
+	MERGE_COMMIT:      "○",
+	T_DOWN_CONNECTOR:  "┬",
+	T_UP_CONNECTOR:    "┴",
+	T_LEFT_CONNECTOR:  "├",
+	T_RIGHT_CONNECTOR: "┤",
+	CROSS_CONNECTOR:   "┼",
+	COLLAPSED_MERGE:   "⊕",
+	COLLAPSED_CHAIN:   "◎",
+	OVERFLOW:          "┆",
+}
+
+var HEAVY_GLYPHS = GlyphSet{
+	BLANK:             " ",
+	VERTICAL:          "┃",
+	HORIZONTAL:        "━",
+	DOWN_RIGHT_CORNER: "┛",
+	UP_RIGTH_CORNER:   "┓",
+	UP_LEFT_CORNER:    "┏",
+	COMMIT:            "●",
+	MERGE_COMMIT:      "○",
+	T_DOWN_CONNECTOR:  "┳",
+	T_UP_CONNECTOR:    "┻",
+	T_LEFT_CONNECTOR:  "┣",
+	T_RIGHT_CONNECTOR: "┫",
+	CROSS_CONNECTOR:   "╋",
+	COLLAPSED_MERGE:   "⊕",
+	COLLAPSED_CHAIN:   "◎",
+	OVERFLOW:          "┇",
+}
+
+var ASCII_GLYPHS = GlyphSet{
+	BLANK:             " ",
+	VERTICAL:          "|",
+	HORIZONTAL:        "-",
+	DOWN_RIGHT_CORNER: "/",
+	UP_RIGTH_CORNER:   "\\",
+	UP_LEFT_CORNER:    "/",
+	COMMIT:            "*",
+	MERGE_COMMIT:      "o",
+	T_DOWN_CONNECTOR:  "+",
+	T_UP_CONNECTOR:    "+",
+	T_LEFT_CONNECTOR:  "+",
+	T_RIGHT_CONNECTOR: "+",
+	CROSS_CONNECTOR:   "+",
+	COLLAPSED_MERGE:   "@",
+	COLLAPSED_CHAIN:   "=",
+	OVERFLOW:          ":",
+}
+
+var GLYPH_SETS = map[string]GlyphSet{
+	"rounded": ROUNDED_GLYPHS,
+	"heavy":   HEAVY_GLYPHS,
+	"ascii":   ASCII_GLYPHS,
+}
+
+func GlyphSetByName(name string) (GlyphSet, error) {
+	glyphs, exists := GLYPH_SETS[name]
+	if !exists {
+		return GlyphSet{}, fmt.Errorf("unknown glyph set %q, expected one of: rounded, heavy, ascii", name)
+	}
+	return glyphs, nil
+}
+
+type RenderOptions struct {
+	Glyphs   GlyphSet
+	Color    color.Profile
+	Theme    theme.Theme
+	XSpacing int
+	YSpacing int
+	// Format of the text next to each commit, the default preset when nil
+	Template *commit_pkg.Template
+	// Lanes drawn at most, the ones past the last are folded into an
+	// overflow lane. No limit when 0
+	MaxLanes int
+}
+
+func DefaultRenderOptions() RenderOptions {
+	return RenderOptions{
+		Glyphs:   ROUNDED_GLYPHS,
+		Color:    color.TrueColor,
+		Theme:    theme.Dark,
+		XSpacing: X_SPACING,
+		YSpacing: Y_SPACING,
+		Template: default_template,
+	}
+}
+
+// withDefaults fills the sizes left unset, so options built as a literal
+// render like the defaults.
+func (o RenderOptions) withDefaults() RenderOptions {
+	if o.XSpacing == 0 {
+		o.XSpacing = X_SPACING
+	}
+	if o.YSpacing == 0 {
+		o.YSpacing = Y_SPACING
+	}
+	if o.Template == nil {
+		o.Template = default_template
+	}
+	return o
+}
+
+// Line is one rendered row of the graph. Rows drawn between commits only have
+// the Graph part, Text is the formatted commit and Plain the same without colors.
+type Line struct {
+	Graph  string
+	Hash   string
+	Text   string
+	Plain  string
+	Commit *Commit
 }
 
-const RESET_COLOR = "\033[0m"
+func (l Line) String() string {
+	return l.Graph + l.Text
+}
 
 const X_SPACING = 4
 const Y_SPACING = 2
 
+var default_template, _ = commit_pkg.ParseTemplate(commit_pkg.DefaultTemplate)
+
 type gridCell struct {
-	glyph        string
+	glyph        Glyph
 	destinationX int
 }
 
-func (g *gridCell) getColor() string {
-	return COLLORS_PALLETE[g.destinationX%len(COLLORS_PALLETE)]
+// Lines leaving a cell towards its sides
+const (
+	arm_up = 1 << iota
+	arm_down
+	arm_left
+	arm_right
+)
+
+var glyph_arms = map[Glyph]int{
+	VERTICAL:          arm_up | arm_down,
+	HORIZONTAL:        arm_left | arm_right,
+	DOWN_RIGHT_CORNER: arm_up | arm_left,
+	UP_RIGTH_CORNER:   arm_down | arm_left,
+	UP_LEFT_CORNER:    arm_down | arm_right,
+	T_DOWN_CONNECTOR:  arm_left | arm_right | arm_down,
+	T_UP_CONNECTOR:    arm_left | arm_right | arm_up,
+	T_LEFT_CONNECTOR:  arm_up | arm_down | arm_right,
+	T_RIGHT_CONNECTOR: arm_up | arm_down | arm_left,
+	CROSS_CONNECTOR:   arm_up | arm_down | arm_left | arm_right,
 }
 
-func DrawGraph(commits_map map[string]*Commit, maxX, maxY int) string {
-	commits := make(map[int]string)
+// join draws glyph over the cell keeping the lines already in it, so a line
+// drawn across a lane is a CROSS_CONNECTOR
+func (g *gridCell) join(glyph Glyph) Glyph {
+	arms, exists := glyph_arms[g.glyph]
+	if g.glyph != BLANK && !exists {
+		return g.glyph
+	}
+	arms |= glyph_arms[glyph]
+	for joined, joined_arms := range glyph_arms {
+		if joined_arms == arms {
+			return joined
+		}
+	}
+	return glyph
+}
+
+func (g *gridCell) getColor(t theme.Theme) color.RGB {
+	if (g.glyph == COMMIT || g.glyph == COLLAPSED_CHAIN) && t.Commit != nil {
+		return *t.Commit
+	}
+	if (g.glyph == MERGE_COMMIT || g.glyph == COLLAPSED_MERGE) && t.Merge != nil {
+		return *t.Merge
+	}
+	return t.Lane(g.destinationX)
+}
+
+func DrawGraph(commits_map map[string]*Commit, maxX, maxY int, options RenderOptions) string {
+	var result strings.Builder
+	for _, line := range DrawGraphLines(commits_map, maxX, maxY, options) {
+		result.WriteString(line.String() + "\n")
+	}
+	return result.String()
+}
+
+func DrawGraphLines(commits_map map[string]*Commit, maxX, maxY int, options RenderOptions) []Line {
+	options = options.withDefaults()
+	x_spacing, y_spacing := options.XSpacing, options.YSpacing
+	commits := make(map[int]*Commit)
+	folded := options.MaxLanes > 0 && maxX >= options.MaxLanes
+	originals := commits_map
+	if folded {
+		commits_map = lanesByUse(commits_map, maxX, options.MaxLanes-1)
+	}
 
 	// Create grid with spaces
-	grid := make([][]gridCell, maxY*Y_SPACING+1)
+	grid := make([][]gridCell, maxY*y_spacing+1)
 	for y := range grid {
-		grid[y] = make([]gridCell, maxX*X_SPACING+1)
+		grid[y] = make([]gridCell, maxX*x_spacing+1)
 		for x := range grid[y] {
-			grid[y][x] = gridCell{" ", x}
+			grid[y][x] = gridCell{BLANK, x}
 		}
 	}
 
@@ -59,7 +245,7 @@ func DrawGraph(commits_map map[string]*Commit, maxX, maxY int) string {
 		return strings.HasPrefix(commit.Hash, "dummy_")
 	}
 
-	for _, commit := range commits_map {
+	for _, commit := range SortCommits(commits_map) {
 		commit_glyph := COMMIT
 		if if_dummy_commits(commit) {
 			commit_glyph = VERTICAL
@@ -71,10 +257,15 @@ func DrawGraph(commits_map map[string]*Commit, maxX, maxY int) string {
 			commit_glyph = MERGE_COMMIT
 			is_merge_commit = true
 		}
+		if commit.Summary {
+			commit_glyph = COLLAPSED_CHAIN
+		} else if commit.Collapsed > 0 {
+			commit_glyph = COLLAPSED_MERGE
+		}
 
-		grid[commit.Y_pos*Y_SPACING][commit.X_pos*X_SPACING] = gridCell{commit_glyph, commit.X_pos}
+		grid[commit.Y_pos*y_spacing][commit.X_pos*x_spacing] = gridCell{commit_glyph, commit.X_pos}
 		if !if_dummy_commits(commit) {
-			commits[commit.Y_pos*Y_SPACING] = commit.Format(20)
+			commits[commit.Y_pos*y_spacing] = commit
 		}
 
 		for parent_no, parent_hash := range commit.Parents {
@@ -91,8 +282,8 @@ func DrawGraph(commits_map map[string]*Commit, maxX, maxY int) string {
 				logger.Fatal(fmt.Sprintf("y_distance < 0 %d from %s to %s", y_distance, commit.Hash[:8], parent.Hash[:8]))
 			}
 
-			y_start := commit.Y_pos * Y_SPACING
-			y_end := parent.Y_pos * Y_SPACING
+			y_start := commit.Y_pos * y_spacing
+			y_end := parent.Y_pos * y_spacing
 			x_end := 0
 			destinationX := parent.X_pos
 
@@ -105,36 +296,23 @@ func DrawGraph(commits_map map[string]*Commit, maxX, maxY int) string {
 			   ┃   ┃  ●
 			*/
 			if x_distance > 0 {
-				x_start := commit.X_pos * X_SPACING
-				x_end = x_start + x_distance*X_SPACING
+				x_start := commit.X_pos * x_spacing
+				x_end = x_start + x_distance*x_spacing
 				destinationX = parent.X_pos
 
-				if grid[y_start+1][x_start].glyph == T_RIGHT_CONNECTOR {
-					grid[y_start+1][x_start] = gridCell{CROSS_CONNECTOR, commit.X_pos}
-				} else {
-					grid[y_start+1][x_start] = gridCell{T_LEFT_CONNECTOR, commit.X_pos}
-				}
+				grid[y_start+1][x_start] = gridCell{grid[y_start+1][x_start].join(T_LEFT_CONNECTOR), commit.X_pos}
 
 				for i := x_start + 1; i < x_end; i++ {
 					cell := grid[y_start+1][i]
+					grid[y_start+1][i].glyph = cell.join(HORIZONTAL)
 
-					if cell.glyph == VERTICAL || cell.glyph == " " {
-						grid[y_start+1][i] = gridCell{HORIZONTAL, destinationX}
-					} else if cell.glyph == UP_RIGTH_CORNER {
-						grid[y_start+1][i] = gridCell{T_DOWN_CONNECTOR, cell.destinationX}
-					}
-
-					if destinationX < cell.destinationX {
+					if cell.glyph == BLANK || cell.glyph == VERTICAL || destinationX < cell.destinationX {
 						grid[y_start+1][i].destinationX = destinationX
 					}
 
 				}
 
-				if grid[y_start+1][x_end].glyph == " " || grid[y_start+1][x_end].glyph == VERTICAL {
-					grid[y_start+1][x_end] = gridCell{UP_RIGTH_CORNER, destinationX}
-				} else if grid[y_start+1][x_end].glyph == HORIZONTAL {
-					grid[y_start+1][x_end] = gridCell{T_DOWN_CONNECTOR, destinationX}
-				}
+				grid[y_start+1][x_end] = gridCell{grid[y_start+1][x_end].join(UP_RIGTH_CORNER), destinationX}
 
 				/* resolve branching to right
 
@@ -145,37 +323,24 @@ func DrawGraph(commits_map map[string]*Commit, maxX, maxY int) string {
 				   ┃
 				*/
 			} else if x_distance < 0 && (!is_merge_commit || (is_merge_commit && parent_no == 0)) {
-				x_start := parent.X_pos * X_SPACING
-				x_end = x_start + (-1)*x_distance*X_SPACING
+				x_start := parent.X_pos * x_spacing
+				x_end = x_start + (-1)*x_distance*x_spacing
 
 				destinationX = commit.X_pos
 
-				if grid[y_end-1][x_start].glyph == T_RIGHT_CONNECTOR {
-					grid[y_end-1][x_start] = gridCell{CROSS_CONNECTOR, parent.X_pos}
-				} else {
-					grid[y_end-1][x_start] = gridCell{T_LEFT_CONNECTOR, parent.X_pos}
-				}
+				grid[y_end-1][x_start] = gridCell{grid[y_end-1][x_start].join(T_LEFT_CONNECTOR), parent.X_pos}
 
 				for i := x_start + 1; i < x_end; i++ {
 					cell := grid[y_end-1][i]
+					grid[y_end-1][i].glyph = cell.join(HORIZONTAL)
 
-					if cell.glyph == VERTICAL || cell.glyph == " " {
-						grid[y_end-1][i] = gridCell{HORIZONTAL, destinationX}
-					} else if cell.glyph == DOWN_RIGHT_CORNER {
-						grid[y_end-1][i] = gridCell{T_UP_CONNECTOR, cell.destinationX}
-					}
-
-					if destinationX < cell.destinationX {
+					if cell.glyph == BLANK || cell.glyph == VERTICAL || destinationX < cell.destinationX {
 						grid[y_end-1][i].destinationX = destinationX
 					}
 
 				}
 
-				if grid[y_end-1][x_end].glyph == " " || grid[y_end-1][x_end].glyph == VERTICAL {
-					grid[y_end-1][x_end] = gridCell{DOWN_RIGHT_CORNER, destinationX}
-				} else if grid[y_end-1][x_end].glyph == HORIZONTAL {
-					grid[y_end-1][x_end] = gridCell{T_UP_CONNECTOR, destinationX}
-				}
+				grid[y_end-1][x_end] = gridCell{grid[y_end-1][x_end].join(DOWN_RIGHT_CORNER), destinationX}
 				/*
 					resolve merge to left
 
@@ -188,52 +353,127 @@ func DrawGraph(commits_map map[string]*Commit, maxX, maxY int) string {
 				*/
 
 			} else if x_distance < 0 && is_merge_commit && parent_no != 0 {
-				x_start := parent.X_pos * X_SPACING
-				x_end = x_start + (-1)*x_distance*X_SPACING
+				x_start := parent.X_pos * x_spacing
+				x_end = x_start + (-1)*x_distance*x_spacing
 
-				if grid[y_start+1][x_start].glyph == T_RIGHT_CONNECTOR {
-					grid[y_start+1][x_start] = gridCell{CROSS_CONNECTOR, parent.X_pos}
-				} else {
-					grid[y_start+1][x_start] = gridCell{T_LEFT_CONNECTOR, parent.X_pos}
-				}
+				grid[y_start+1][x_start] = gridCell{grid[y_start+1][x_start].join(T_LEFT_CONNECTOR), parent.X_pos}
 
 				for i := x_start + 1; i < x_end; i++ {
-					grid[y_start+1][i] = gridCell{HORIZONTAL, parent.X_pos}
+					grid[y_start+1][i] = gridCell{grid[y_start+1][i].join(HORIZONTAL), parent.X_pos}
 				}
 
-				if grid[y_start+1][x_end].glyph == T_LEFT_CONNECTOR {
-					grid[y_start+1][x_end] = gridCell{CROSS_CONNECTOR, commit.X_pos}
-				} else {
-					grid[y_start+1][x_end] = gridCell{T_RIGHT_CONNECTOR, commit.X_pos}
-				}
+				grid[y_start+1][x_end] = gridCell{grid[y_start+1][x_end].join(T_RIGHT_CONNECTOR), commit.X_pos}
 
 				continue
 
 			} else {
-				x_end = commit.X_pos * X_SPACING
+				x_end = commit.X_pos * x_spacing
 			}
-			// go down
+			// go down, crossing the edges already drawn over the lane
 			for i := y_start + 1; i < y_end; i++ {
-				if grid[i][x_end].glyph == " " {
+				if grid[i][x_end].glyph == BLANK {
 					grid[i][x_end] = gridCell{VERTICAL, destinationX}
+				} else if grid[i][x_end].glyph == HORIZONTAL {
+					grid[i][x_end].glyph = CROSS_CONNECTOR
 				}
 			}
 		}
 	}
-	return gridToString(grid, commits)
+	if folded {
+		foldLanes(grid, commits, options.MaxLanes-1, x_spacing)
+		for y, commit := range commits {
+			commits[y] = originals[commit.Hash]
+		}
+	}
+	return gridToLines(grid, commits, options)
 }
 
-func gridToString(grid [][]gridCell, commits map[int]string) string {
-	var result strings.Builder
+func formatCommitText(commit *Commit, options RenderOptions) string {
+	t := options.Theme
+	return options.Template.Expand(commit, func(placeholder commit_pkg.Placeholder, text string) string {
+		switch placeholder {
+		case commit_pkg.HashFull, commit_pkg.HashShort, commit_pkg.ParentsFull, commit_pkg.ParentsShort:
+			return color.Paint(t.Hash, options.Color, text)
+		case commit_pkg.Subject, commit_pkg.BodyText:
+			return color.Paint(t.Message, options.Color, text)
+		case commit_pkg.AuthorName, commit_pkg.AuthorEmail, commit_pkg.CommitterName, commit_pkg.CommitterEmail:
+			return color.Paint(t.Author, options.Color, text)
+		case commit_pkg.Decorations, commit_pkg.DecorationsBare:
+			return formatRefs(commit.Refs, text, options)
+		}
+		return color.Paint(t.Date, options.Color, text)
+	})
+}
+
+// formatRefs paints each ref with the color of its kind. Truncated refs are
+// painted as a whole with the refs color.
+func formatRefs(refs []commit_pkg.Ref, text string, options RenderOptions) string {
+	t := options.Theme
+	prefix, suffix := "", ""
+	if strings.HasPrefix(text, " (") && strings.HasSuffix(text, ")") {
+		prefix, suffix = " (", ")"
+	}
+	if text != prefix+commit_pkg.FormatRefs(refs)+suffix {
+		return color.Paint(t.Refs, options.Color, text)
+	}
+	parts := make([]string, len(refs))
+	for i, ref := range refs {
+		parts[i] = color.Paint(refColor(t, ref.Kind), options.Color, ref.String())
+	}
+	separator := color.Paint(t.Refs, options.Color, ", ")
+	return color.Paint(t.Refs, options.Color, prefix) + strings.Join(parts, separator) + color.Paint(t.Refs, options.Color, suffix)
+}
+
+func refColor(t theme.Theme, kind commit_pkg.RefKind) *color.RGB {
+	kind_color := t.Refs
+	switch kind {
+	case commit_pkg.RefHead, commit_pkg.RefWorktree:
+		kind_color = t.Head
+	case commit_pkg.RefBranch:
+		kind_color = t.Branch
+	case commit_pkg.RefRemoteBranch:
+		kind_color = t.Remote
+	case commit_pkg.RefTag:
+		kind_color = t.Tag
+	}
+	if kind_color == nil {
+		return t.Refs
+	}
+	return kind_color
+}
+
+func gridToLines(grid [][]gridCell, commits map[int]*Commit, options RenderOptions) []Line {
+	lines := make([]Line, len(grid))
 	for i, row := range grid {
+		var result strings.Builder
+		// Escape codes are written only when the color changes, blank cells keep the current one
+		current_color := ""
 		for _, cell := range row {
-			result.WriteString(cell.getColor() + cell.glyph + RESET_COLOR)
+			if cell.glyph != BLANK {
+				if cell_color := cell.getColor(options.Theme).Foreground(options.Color); cell_color != current_color {
+					result.WriteString(cell_color)
+					current_color = cell_color
+				}
+			}
+			result.WriteString(options.Glyphs[cell.glyph])
 		}
-		if _, exists := commits[i]; exists {
-			result.WriteString(strings.Repeat(" ", 2*X_SPACING) + commits[i])
+		if current_color != "" {
+			result.WriteString(color.Reset)
 		}
-		result.WriteString("\n")
+		if commit, exists := commits[i]; exists {
+			result.WriteString(strings.Repeat(" ", 2*options.XSpacing))
+			lines[i].Hash = commit.Hash
+			lines[i].Commit = commit
+			lines[i].Text = formatCommitText(commit, options)
+			lines[i].Plain = options.Template.Format(commit)
+			if commit.Collapsed > 0 && !commit.Summary {
+				// Number of commits hidden behind a collapsed merge
+				marker := fmt.Sprintf(" [+%d]", commit.Collapsed)
+				lines[i].Text += color.Paint(options.Theme.Refs, options.Color, marker)
+				lines[i].Plain += marker
+			}
+		}
+		lines[i].Graph = result.String()
 	}
-
-	return result.String()
+	return lines
 }
@@ -0,0 +1,32 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+
+	color "git-graph/pkg/color"
+	theme "git-graph/pkg/theme"
+)
+
+func TestGridToStringColorChanges(t *testing.T) {
+	grid := [][]gridCell{{
+		{VERTICAL, 0},
+		{BLANK, 1},
+		{HORIZONTAL, 0},
+		{HORIZONTAL, 1},
+	}}
+	options := RenderOptions{Glyphs: ASCII_GLYPHS, Color: color.ANSI256, Theme: theme.Dark}
+	output := gridToLines(grid, map[int]*Commit{}, options)[0].String()
+
+	first := theme.Dark.Lanes[0].Foreground(color.ANSI256)
+	second := theme.Dark.Lanes[1].Foreground(color.ANSI256)
+	expected := first + "| -" + second + "-" + color.Reset
+	if output != expected {
+		t.Errorf("expected %q, got %q", expected, output)
+	}
+
+	options.Color = color.NoColor
+	if output := gridToLines(grid, map[int]*Commit{}, options)[0].String(); strings.Contains(output, "\033") {
+		t.Errorf("expected no escape codes, got %q", output)
+	}
+}
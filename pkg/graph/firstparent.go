@@ -0,0 +1,173 @@
+package graph
+
+import (
+	"slices"
+	"sort"
+)
+
+// FirstParentView lays out the first-parent chains of a history only, like
+// git log --first-parent. Each merge on them is a single node standing for
+// the commits it brought in, which Toggle shows and hides again.
+type FirstParentView struct {
+	commits  map[string]Commit
+	options  RenderOptions
+	mainline map[string]bool
+	// Commits each merge brought in and the merge owning each of them
+	brought  map[string][]string
+	owners   map[string]string
+	expanded map[string]bool
+}
+
+func NewFirstParentView(commits map[string]Commit, options RenderOptions) *FirstParentView {
+	v := &FirstParentView{
+		commits:  commits,
+		options:  options,
+		mainline: make(map[string]bool),
+		brought:  make(map[string][]string),
+		owners:   make(map[string]string),
+		expanded: make(map[string]bool),
+	}
+	v.findMainline()
+	v.assignBrought()
+	return v
+}
+
+// findMainline follows the first parents from every commit without children.
+func (v *FirstParentView) findMainline() {
+	has_children := make(map[string]bool, len(v.commits))
+	for _, c := range v.commits {
+		for _, parent_hash := range c.Parents {
+			has_children[parent_hash] = true
+		}
+	}
+	for hash := range v.commits {
+		if has_children[hash] {
+			continue
+		}
+		for hash != "" && !v.mainline[hash] {
+			c, exists := v.commits[hash]
+			if !exists {
+				break
+			}
+			v.mainline[hash] = true
+			hash = ""
+			if len(c.Parents) > 0 {
+				hash = c.Parents[0]
+			}
+		}
+	}
+}
+
+// assignBrought gives every commit off the mainline to the merge that brought
+// it in. Merges are visited parents first, so the commits already reachable
+// from the first parent are taken; with several chains a commit merged more
+// than once belongs to the oldest merge.
+func (v *FirstParentView) assignBrought() {
+	commits_map := ComputeCommitsMap(&v.commits)
+	children_map := ComputeChildrenMap(&v.commits)
+	generations := ComputeGenerationNumbers(commits_map, GetTopCommits(commits_map, children_map))
+
+	mainline := make([]string, 0, len(v.mainline))
+	for hash := range v.mainline {
+		mainline = append(mainline, hash)
+	}
+	sort.Slice(mainline, func(i, j int) bool {
+		if generations[mainline[i]] == generations[mainline[j]] {
+			return mainline[i] < mainline[j]
+		}
+		return generations[mainline[i]] < generations[mainline[j]]
+	})
+
+	seen := make(map[string]bool, len(v.commits))
+	for _, merge_hash := range mainline {
+		seen[merge_hash] = true
+		parents := v.commits[merge_hash].Parents
+		if len(parents) < 2 {
+			continue
+		}
+		stack := slices.Clone(parents[1:])
+		for len(stack) > 0 {
+			hash := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			c, exists := v.commits[hash]
+			if !exists || seen[hash] || v.mainline[hash] {
+				continue
+			}
+			seen[hash] = true
+			v.owners[hash] = merge_hash
+			v.brought[merge_hash] = append(v.brought[merge_hash], hash)
+			stack = append(stack, c.Parents...)
+		}
+	}
+}
+
+// Toggle expands the merge hash, or collapses it again. For a commit brought
+// in by an expanded merge, that merge is collapsed. It returns the merge
+// toggled, empty when hash is neither.
+func (v *FirstParentView) Toggle(hash string) string {
+	if owner, exists := v.owners[hash]; exists && v.expanded[owner] {
+		hash = owner
+	}
+	if len(v.brought[hash]) == 0 {
+		return ""
+	}
+	v.expanded[hash] = !v.expanded[hash]
+	return hash
+}
+
+func (v *FirstParentView) visible(hash string) bool {
+	return v.mainline[hash] || v.expanded[v.owners[hash]]
+}
+
+// Commits returns the commits to lay out: the mainline and what the expanded
+// merges brought in. Collapsed merges keep their parents on the mainline
+// only, edges to hidden commits lead to their first visible first parent.
+func (v *FirstParentView) Commits() map[string]Commit {
+	result := make(map[string]Commit, len(v.mainline))
+	for hash, c := range v.commits {
+		if !v.visible(hash) {
+			continue
+		}
+		collapsed := v.mainline[hash] && len(v.brought[hash]) > 0 && !v.expanded[hash]
+		parents := make([]string, 0, len(c.Parents))
+		for i, parent_hash := range c.Parents {
+			if collapsed && i > 0 && !v.mainline[parent_hash] {
+				continue
+			}
+			parent_hash = v.firstVisible(parent_hash)
+			if _, exists := v.commits[parent_hash]; exists && !v.visible(parent_hash) {
+				continue
+			}
+			if !slices.Contains(parents, parent_hash) {
+				parents = append(parents, parent_hash)
+			}
+		}
+		c.Parents = parents
+		c.Collapsed = 0
+		if collapsed {
+			c.Collapsed = len(v.brought[hash])
+		}
+		result[hash] = c
+	}
+	return result
+}
+
+// firstVisible follows the first parents of a hidden commit down to a shown
+// one, a hidden root is returned when there is none. Commits outside the
+// history are returned as they are.
+func (v *FirstParentView) firstVisible(hash string) string {
+	for !v.visible(hash) {
+		c, exists := v.commits[hash]
+		if !exists || len(c.Parents) == 0 {
+			return hash
+		}
+		hash = c.Parents[0]
+	}
+	return hash
+}
+
+// Lines lays out and draws the commits currently shown.
+func (v *FirstParentView) Lines() []Line {
+	commits := v.Commits()
+	return ProcessCommits(&commits, v.options)
+}
@@ -0,0 +1,88 @@
+package graph
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	color "git-graph/pkg/color"
+	commit_pkg "git-graph/pkg/commit"
+)
+
+func TestFirstParentView(t *testing.T) {
+	// main: a - b ----------- m - c
+	//        \               /
+	// feature: f1 - f2 --- f3
+	//                \   /
+	// fix:             x1
+	commits, err := commit_pkg.NewBuilder().
+		Add("aaaaaaaa", "a").
+		Add("bbbbbbbb", "b", "aaaaaaaa").
+		Add("f1f1f1f1", "f1", "aaaaaaaa").
+		Add("f2f2f2f2", "f2", "f1f1f1f1").
+		Add("x1x1x1x1", "x1", "f2f2f2f2").
+		Add("f3f3f3f3", "f3", "f2f2f2f2", "x1x1x1x1").
+		Add("mmmmmmmm", "merge feature", "bbbbbbbb", "f3f3f3f3").
+		Add("cccccccc", "c", "mmmmmmmm").
+		Commits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := DefaultRenderOptions()
+	options.Color = color.NoColor
+	options.Glyphs = ASCII_GLYPHS
+	view := NewFirstParentView(commits, options)
+
+	shown := func() []string {
+		hashes := []string{}
+		for hash := range view.Commits() {
+			hashes = append(hashes, hash[:2])
+		}
+		slices.Sort(hashes)
+		return hashes
+	}
+	if hashes := shown(); !slices.Equal(hashes, []string{"aa", "bb", "cc", "mm"}) {
+		t.Errorf("expected the mainline only, got %v", hashes)
+	}
+	merge := view.Commits()["mmmmmmmm"]
+	if merge.Collapsed != 4 || !slices.Equal(merge.Parents, []string{"bbbbbbbb"}) {
+		t.Errorf("expected a collapsed merge of 4 commits, got %d with parents %v", merge.Collapsed, merge.Parents)
+	}
+	lines := view.Lines()
+	if text := linesText(lines); !strings.Contains(text, "@") || !strings.Contains(text, "[+4]") {
+		t.Errorf("expected a collapsed merge glyph and count:\n%s", text)
+	}
+
+	if toggled := view.Toggle("bbbbbbbb"); toggled != "" {
+		t.Errorf("a commit without merged commits should not toggle, got %s", toggled)
+	}
+	if toggled := view.Toggle("mmmmmmmm"); toggled != "mmmmmmmm" {
+		t.Fatalf("expected the merge to expand, got %q", toggled)
+	}
+	if hashes := shown(); len(hashes) != len(commits) {
+		t.Errorf("expected every commit once the merge is expanded, got %v", hashes)
+	}
+	if merge := view.Commits()["mmmmmmmm"]; merge.Collapsed != 0 || len(merge.Parents) != 2 {
+		t.Errorf("expected the expanded merge to keep both parents, got %+v", merge)
+	}
+	expanded := view.Commits()
+	if violations := Validate(ComputeLayout(&expanded).Commits); len(violations) > 0 {
+		t.Errorf("layout violations: %v", violations)
+	}
+
+	// Toggling a merged commit collapses the merge again
+	if toggled := view.Toggle("x1x1x1x1"); toggled != "mmmmmmmm" {
+		t.Errorf("expected the merge of x1 to collapse, got %q", toggled)
+	}
+	if hashes := shown(); len(hashes) != 4 {
+		t.Errorf("expected the mainline only after collapsing, got %v", hashes)
+	}
+}
+
+func linesText(lines []Line) string {
+	var text strings.Builder
+	for _, line := range lines {
+		text.WriteString(line.String() + "\n")
+	}
+	return text.String()
+}
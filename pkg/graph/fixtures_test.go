@@ -0,0 +1,56 @@
+package graph
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	commit_pkg "git-graph/pkg/commit"
+)
+
+// fixtureSource reads the fixture recorded for a scenario
+func fixtureSource(name string) commit_pkg.JSONSource {
+	return commit_pkg.JSONSource{Path: filepath.Join("testdata", "fixtures", name+".json")}
+}
+
+func loadFixture(t testing.TB, name string) map[string]Commit {
+	t.Helper()
+	commits, err := fixtureSource(name).Commits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return commits
+}
+
+// layoutHistories returns the histories the layout checks run on: synthetic
+// ones of a few sizes and widths, and every recorded fixture.
+func layoutHistories(t testing.TB) map[string]map[string]Commit {
+	t.Helper()
+	histories := map[string]map[string]Commit{}
+	for _, size := range []int{50, 300} {
+		for _, branches := range []int{4, 16, 32} {
+			histories[fmt.Sprintf("synthetic-%d-%d", size, branches)] = syntheticHistory(size, branches)
+		}
+	}
+	for _, s := range synthetic_scenarios {
+		histories[s.name] = loadFixture(t, s.name)
+	}
+	return histories
+}
+
+// eachLayout lays out every history of layoutHistories in every order, with
+// and without crossing reduction, and passes the layouts to check.
+func eachLayout(t *testing.T, check func(name string, layout Layout)) {
+	t.Helper()
+	defer SetOrder(layout_order)
+	defer SetReduceCrossings(reduce_crossings)
+	for name, commits := range layoutHistories(t) {
+		for order_name, order := range ORDERS {
+			SetOrder(order)
+			for _, reduce := range []bool{false, true} {
+				SetReduceCrossings(reduce)
+				check(fmt.Sprintf("%s, %s order, reducing crossings %t", name, order_name, reduce), ComputeLayout(&commits))
+			}
+		}
+	}
+}
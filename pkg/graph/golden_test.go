@@ -0,0 +1,174 @@
+package graph
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	color "git-graph/pkg/color"
+	commit_pkg "git-graph/pkg/commit"
+	theme "git-graph/pkg/theme"
+)
+
+var update = flag.Bool("update", false, "regenerate golden files in testdata/golden")
+var record = flag.Bool("record", false, "rebuild testdata/fixtures from scripts/create-synthetic-repo.sh (needs bash and git)")
+
+type scenario struct {
+	name   string
+	script string
+}
+
+// Scenarios built by scripts/create-synthetic-repo.sh
+var synthetic_scenarios = []scenario{
+	{"many-merges-readable", "-mr"},
+	{"many-merges-minimal", "-mm"},
+	{"canonical-octopus", "-com"},
+	{"octopus-from-inside", "-omi"},
+}
+
+func TestMain(m *testing.M) {
+	// Commit dates are printed in local time
+	time.Local = time.UTC
+	os.Exit(m.Run())
+}
+
+func TestGoldenSynthetic(t *testing.T) {
+	for _, s := range synthetic_scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			fixture, err := filepath.Abs(filepath.Join("testdata", "fixtures", s.name+".json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *record {
+				recordFixture(t, s, fixture)
+			}
+			checkGolden(t, s.name, loadFixture(t, s.name))
+		})
+	}
+}
+
+func TestGoldenBuilder(t *testing.T) {
+	scenarios := map[string]*commit_pkg.Builder{
+		"linear": commit_pkg.NewBuilder().
+			Add("aaaaaaa1", "first").
+			Add("aaaaaaa2", "second", "aaaaaaa1").
+			Add("aaaaaaa3", "third", "aaaaaaa2").
+			Refs("aaaaaaa3", "HEAD -> master"),
+		"fork-and-merge": commit_pkg.NewBuilder().
+			Add("bbbbbbb1", "base").
+			Add("bbbbbbb2", "feature", "bbbbbbb1").
+			Add("bbbbbbb3", "main", "bbbbbbb1").
+			Add("bbbbbbb4", "merge", "bbbbbbb3", "bbbbbbb2").
+			Add("bbbbbbb5", "after merge", "bbbbbbb4").
+			Refs("bbbbbbb5", "HEAD -> master"),
+	}
+	for name, builder := range scenarios {
+		t.Run(name, func(t *testing.T) {
+			commits, err := builder.Commits()
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, name, commits)
+		})
+	}
+}
+
+func TestGoldenGlyphSets(t *testing.T) {
+	for _, name := range []string{"heavy", "ascii"} {
+		t.Run(name, func(t *testing.T) {
+			glyphs, err := GlyphSetByName(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			commits := loadFixture(t, "many-merges-readable")
+			layout := ComputeLayout(&commits)
+			graph := DrawGraph(layout.Commits, layout.MaxX, layout.MaxY, RenderOptions{Glyphs: glyphs, Color: color.NoColor, Theme: theme.Dark})
+			compareGolden(t, filepath.Join("testdata", "golden", "many-merges-readable."+name+".txt"), graph)
+		})
+	}
+}
+
+func checkGolden(t *testing.T, name string, commits map[string]Commit) {
+	t.Helper()
+	layout := ComputeLayout(&commits)
+	// Colors are disabled to keep golden files readable in diffs
+	options := DefaultRenderOptions()
+	options.Color = color.NoColor
+	graph := DrawGraph(layout.Commits, layout.MaxX, layout.MaxY, options)
+
+	compareGolden(t, filepath.Join("testdata", "golden", name+".txt"), graph)
+	compareGolden(t, filepath.Join("testdata", "golden", name+".pos"), formatPositions(layout.Commits))
+
+	if violations := Validate(layout.Commits); len(violations) > 0 {
+		t.Errorf("layout violations:\n%s", formatViolations(violations))
+	}
+}
+
+func formatPositions(commits_map CommitsMap) string {
+	var result strings.Builder
+	for _, commit := range SortCommits(commits_map) {
+		fmt.Fprintf(&result, "%s x=%d y=%d\n", commit.Hash[:8], commit.X_pos, commit.Y_pos)
+	}
+	return result.String()
+}
+
+func compareGolden(t *testing.T, path, actual string) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(actual), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v, run `go test ./pkg/graph -update` to create it", err)
+	}
+	if string(expected) != actual {
+		t.Errorf("%s differs from the computed output\n--- expected\n%s\n--- actual\n%s", path, expected, actual)
+	}
+}
+
+func recordFixture(t *testing.T, s scenario, fixture string) {
+	t.Helper()
+	script, err := filepath.Abs(filepath.Join("..", "..", "scripts", "create-synthetic-repo.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	cmd := exec.Command("bash", script, s.script)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader("y")
+	cmd.Env = append(os.Environ(), "GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%s %s: %v\n%s", script, s.script, err, output)
+	}
+
+	t.Setenv("GIT_DIR", filepath.Join(dir, ".git"))
+	commits, err := commit_pkg.NativeSource{Args: []string{"--all"}}.Commits()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fixture), 0755); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Create(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := commit_pkg.WriteJSON(file, commits); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	utils "git-graph/pkg/utils"
 	"slices"
 	"sort"
+	"sync"
 )
 
 type Commit = commit_pkg.Commit
@@ -16,23 +17,32 @@ type ChildrenMap = map[string][]string
 var graphMaxX int
 var graphMaxY int
 
+// ComputeLayout keeps its sizes in graphMaxX and graphMaxY, layouts computed
+// concurrently, e.g. a window and a cache update, take turns
+var layout_mutex sync.Mutex
+
 var logger = logger_pkg.GetDefaultLogger()
 
 func ComputeCommitsMap(commits *map[string]Commit) CommitsMap {
-	commit_map := make(CommitsMap)
+	commit_map := make(CommitsMap, len(*commits))
 	for commit_hash, commit := range *commits {
+		// AddDummyCommits rewrites parents, keep the caller's commits untouched
+		commit.Parents = slices.Clone(commit.Parents)
 		commit_map[commit_hash] = &commit
 	}
 	return commit_map
 }
 
 func ComputeChildrenMap(commits *map[string]Commit) ChildrenMap {
-	children_map := make(ChildrenMap)
+	children_map := make(ChildrenMap, len(*commits))
 	for commit_hash, commit := range *commits {
 		for _, parent := range commit.Parents {
 			children_map[parent] = append(children_map[parent], commit_hash)
 		}
 	}
+	for _, children := range children_map {
+		sort.Strings(children)
+	}
 	return children_map
 }
 
@@ -53,6 +63,7 @@ func GetRootCommits(commits_map CommitsMap) []string {
 			}
 		}
 	}
+	sort.Strings(root_commits)
 	return root_commits
 }
 
@@ -63,37 +74,49 @@ func GetTopCommits(commits_map CommitsMap, children_map ChildrenMap) []string {
 			top_commits = append(top_commits, commit_hash)
 		}
 	}
+	sort.Strings(top_commits)
 	return top_commits
 }
 
+// ComputeGenerationNumbers gives roots generation 0 and other commits one more
+// than their highest parent. Commits with a parent outside the graph count as
+// roots. The walk keeps its own stack, long histories would be too deep for
+// recursion.
 func ComputeGenerationNumbers(commits_map CommitsMap, top_commits []string) map[string]int {
-	generation_numbers := make(map[string]int)
+	generation_numbers := make(map[string]int, len(commits_map))
 
-	var compute_generation func(commit *Commit) int
-	compute_generation = func(commit *Commit) int {
-		_, exists := generation_numbers[commit.Hash]
-		if exists {
-			return generation_numbers[commit.Hash]
-		}
-		if len(commit.Parents) == 0 {
-			generation_numbers[commit.Hash] = 0
-			return 0
+	type frame struct {
+		commit      *Commit
+		next_parent int
+		max_parent  int
+	}
+	stack := make([]frame, 0)
+	for _, commit_hash := range top_commits {
+		if _, exists := generation_numbers[commit_hash]; exists {
+			continue
 		}
-		parent_generation_numbers := make([]int, 0)
-		for _, parent_hash := range commit.Parents {
+		stack = append(stack, frame{commit: commits_map[commit_hash], max_parent: -1})
+		for len(stack) > 0 {
+			top := &stack[len(stack)-1]
+			if top.next_parent == len(top.commit.Parents) {
+				generation_numbers[top.commit.Hash] = top.max_parent + 1
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			parent_hash := top.commit.Parents[top.next_parent]
 			parent_commit, exists := commits_map[parent_hash]
 			if !exists {
-				generation_numbers[commit.Hash] = 0
-				return 0
+				generation_numbers[top.commit.Hash] = 0
+				stack = stack[:len(stack)-1]
+				continue
 			}
-			parent_generation_numbers = append(parent_generation_numbers, compute_generation(parent_commit))
+			if generation_number, exists := generation_numbers[parent_hash]; exists {
+				top.max_parent = max(top.max_parent, generation_number)
+				top.next_parent++
+				continue
+			}
+			stack = append(stack, frame{commit: parent_commit, max_parent: -1})
 		}
-		generation_numbers[commit.Hash] = slices.Max(parent_generation_numbers) + 1
-		return generation_numbers[commit.Hash]
-	}
-
-	for _, commit_hash := range top_commits {
-		compute_generation(commits_map[commit_hash])
 	}
 	return generation_numbers
 }
@@ -111,7 +134,10 @@ func UpdateYPositions(commits_map CommitsMap, generation_numbers map[string]int)
 	sort.Slice(sorted_commits, func(i, j int) bool {
 		if sorted_commits[i].GenerationNumber == sorted_commits[j].GenerationNumber {
 			if len(sorted_commits[i].Parents) == len(sorted_commits[j].Parents) {
-				return sorted_commits[i].Timestamp > sorted_commits[j].Timestamp
+				if sorted_commits[i].CommitterTimestamp() == sorted_commits[j].CommitterTimestamp() {
+					return sorted_commits[i].Hash < sorted_commits[j].Hash
+				}
+				return sorted_commits[i].CommitterTimestamp() > sorted_commits[j].CommitterTimestamp()
 			}
 			return len(sorted_commits[i].Parents) < len(sorted_commits[j].Parents)
 		}
@@ -122,11 +148,14 @@ func UpdateYPositions(commits_map CommitsMap, generation_numbers map[string]int)
 	}
 }
 
+// ActiveLanes assigns X_pos walking the commits top to bottom and returns the
+// dummy commits routing merge edges. Lanes and dummy commits are looked up
+// through laneIndex and dummyLanes, the cost is close to linear.
 func ActiveLanes(commits_map CommitsMap, children_map ChildrenMap) map[string]Commit {
-	active_lanes := make(map[int]string)
+	active_lanes := newLaneIndex(commits_map)
 	active_commits := utils.NewSet[string]()
 
-	sorted_commits := make([]*Commit, 0)
+	sorted_commits := make([]*Commit, 0, len(commits_map))
 	for _, commit := range commits_map {
 		sorted_commits = append(sorted_commits, commit)
 	}
@@ -140,17 +169,7 @@ func ActiveLanes(commits_map CommitsMap, children_map ChildrenMap) map[string]Co
 		if c1.Y_pos > c2.Y_pos {
 			c1, c2 = c2, c1
 		}
-		return c1.Parents[0] == c2.Hash
-	}
-
-	get_max_lanes_no := func() int {
-		max_lane := 0
-		for lane_no, commit_hash := range active_lanes {
-			if commit_hash != "" {
-				max_lane = utils.Max(max_lane, lane_no)
-			}
-		}
-		return max_lane
+		return firstParent(c1) == c2.Hash
 	}
 
 	check_diverge_commit := func(commit_hash string) bool {
@@ -162,83 +181,52 @@ func ActiveLanes(commits_map CommitsMap, children_map ChildrenMap) map[string]Co
 	}
 
 	dummy_commits := make(map[string]*Commit)
-	active_dummy_commits := make(map[string]*Commit)
+	active_dummy_commits := newDummyLanes()
+	// Deleted dummy commits must not free their names
+	dummy_counter := 0
 
 	for _, commit := range sorted_commits {
 		is_diverge_commit := check_diverge_commit(commit.Hash)
 
 		lane := -1
 		if is_diverge_commit {
-			lanes := make([]int, 0)
 			// Find only direct branch continuation
-			for lane_no, commit_hash := range active_lanes {
-				if lane_commit, exists := commits_map[commit_hash]; exists && lane_commit.Parents[0] == commit.Hash {
-					lanes = append(lanes, lane_no)
-				}
-			}
-			lane = slices.Min(lanes)
-			// Close all lanes except the one with the minimum lane number
-			for _, lane_no := range lanes {
-				if lane_no != lane {
-					active_lanes[lane_no] = ""
+			lanes := slices.Clone(active_lanes.withFirstParent(commit.Hash))
+			if len(lanes) > 0 {
+				lane = lanes[0]
+				// Close all lanes except the one with the minimum lane number
+				for _, lane_no := range lanes[1:] {
+					active_lanes.set(lane_no, "")
 				}
+				active_lanes.set(lane, commit.Hash)
 			}
-			active_lanes[lane] = commit.Hash
 		} else {
-			for lane_no, commit_hash := range active_lanes {
-				if commit_hash == commit.Hash {
-					lane = lane_no
-					break
-				}
-			}
+			lane = active_lanes.firstWith(commit.Hash)
 		}
 
 		if lane == -1 {
-			lane = 0
-			for {
-				if hash, exists := active_lanes[lane]; !exists || hash == "" {
-					break
-				}
-				lane++
-			}
+			lane = active_lanes.firstFree(0)
 		}
 		commit.X_pos = lane
 
-		for key, dummy_commit := range active_dummy_commits {
+		active_dummy_commits.expire(commit.Y_pos)
+		for _, dummy := range active_dummy_commits.endingAt(commit.Y_pos) {
 			// Delete dummy commit if direct connection exists
-			y_end := commits_map[dummy_commit.Parents[0]].Y_pos
-			if commit.Y_pos == y_end {
-				var branch_commit *Commit
-				for _, child_hash := range children_map[commit.Hash] {
-					if check_if_branch_commits(commit.Hash, child_hash) {
-						branch_commit = commits_map[child_hash]
-					}
-				}
-				if branch_commit == nil || branch_commit.Y_pos < commits_map[dummy_commit.Message].Y_pos {
-					delete(active_dummy_commits, key)
-					delete(dummy_commits, key)
+			var branch_commit *Commit
+			for _, child_hash := range children_map[commit.Hash] {
+				if check_if_branch_commits(commit.Hash, child_hash) {
+					branch_commit = commits_map[child_hash]
 				}
 			}
-
-			if commit.Y_pos > y_end {
-				delete(active_dummy_commits, key)
+			if branch_commit == nil || branch_commit.Y_pos < commits_map[dummy.commit.Message].Y_pos {
+				active_dummy_commits.deactivate(dummy)
+				delete(dummy_commits, dummy.commit.Hash)
 			}
 		}
 
 		// Adjust dummy commits if collides
-		is_collided := false
-		for _, dummy_commit := range active_dummy_commits {
-			if commit.X_pos == dummy_commit.X_pos {
-				is_collided = true
-				break
-			}
-		}
-
-		if is_collided {
-			for _, dummy_commit := range active_dummy_commits {
-				dummy_commit.X_pos++
-				graphMaxX = utils.Max(graphMaxX, dummy_commit.X_pos)
-			}
+		if active_dummy_commits.collides(commit.X_pos) {
+			graphMaxX = utils.Max(graphMaxX, active_dummy_commits.moveRight())
 		}
 
 		if len(commit.Parents) == 0 {
@@ -250,23 +238,27 @@ func ActiveLanes(commits_map CommitsMap, children_map ChildrenMap) map[string]Co
 			new_dummy_commits := make([]*Commit, 0)
 			for _, parent_hash := range commit.Parents[1:] {
 				need_dummy_commit := true
-				for _, commit_hash := range active_lanes {
-					if commit_hash != "" && commits_map[commit_hash].Parents[0] == parent_hash &&
-						commits_map[commit_hash].Y_pos < commit.Y_pos {
+				for _, lane_no := range active_lanes.withFirstParent(parent_hash) {
+					if commits_map[active_lanes.get(lane_no)].Y_pos < commit.Y_pos {
 						need_dummy_commit = false
 						break
 					}
 				}
+				// Parents outside the graph, e.g. excluded by a range, have no row to lead to
+				if _, exists := commits_map[parent_hash]; !exists {
+					need_dummy_commit = false
+				}
 				if need_dummy_commit {
-					x_pos := utils.Max(commit.X_pos, get_max_lanes_no()) + 1
+					x_pos := utils.Max(commit.X_pos, active_lanes.maxOccupied()) + 1
 					y_pos := commit.Y_pos + 1
-					for _, dummy_commit := range active_dummy_commits {
-						if dummy_commit.X_pos == x_pos && dummy_commit.Parents[0] != parent_hash {
+					for _, dummy := range active_dummy_commits.active() {
+						if active_dummy_commits.x(dummy) == x_pos && dummy.commit.Parents[0] != parent_hash {
 							x_pos++
 						}
 					}
 
-					hash := fmt.Sprintf("dummy_%02d", len(dummy_commits))
+					hash := fmt.Sprintf("dummy_%02d", dummy_counter)
+					dummy_counter++
 					dummy_commit := Commit{
 						Hash:    hash,
 						Message: commit.Hash,
@@ -276,11 +268,12 @@ func ActiveLanes(commits_map CommitsMap, children_map ChildrenMap) map[string]Co
 					}
 					graphMaxX = utils.Max(graphMaxX, dummy_commit.X_pos)
 					dummy_commits[hash] = &dummy_commit
-					active_dummy_commits[hash] = &dummy_commit
+					active_dummy_commits.add(&dummy_commit, commits_map[parent_hash].Y_pos)
 					new_dummy_commits = append(new_dummy_commits, &dummy_commit)
 				}
 			}
 
+			// X_pos of active dummy commits share the same shift, swapping them is safe
 			if len(new_dummy_commits) > 1 {
 				for _, adc_1 := range new_dummy_commits {
 					destination_1 := commits_map[adc_1.Parents[0]].Y_pos
@@ -299,13 +292,13 @@ func ActiveLanes(commits_map CommitsMap, children_map ChildrenMap) map[string]Co
 		first_parent := commit.Parents[0]
 		if !active_commits.Exists(first_parent) {
 			if check_diverge_commit(first_parent) {
-				active_commits.Delete(active_lanes[lane])
+				active_commits.Delete(active_lanes.get(lane))
 				active_commits.Add(commit.Hash)
-				active_lanes[lane] = commit.Hash
+				active_lanes.set(lane, commit.Hash)
 			} else {
 				active_commits.Delete(commit.Hash)
 				active_commits.Add(first_parent)
-				active_lanes[lane] = first_parent
+				active_lanes.set(lane, first_parent)
 			}
 		}
 
@@ -313,23 +306,18 @@ func ActiveLanes(commits_map CommitsMap, children_map ChildrenMap) map[string]Co
 		for _, parent_hash := range commit.Parents[1:] {
 			if _, exists := commits_map[parent_hash]; exists {
 				// Find the next available lane for this parent
-				parent_lane := lane
-				for {
-					if hash, exists := active_lanes[parent_lane]; !exists || hash == "" {
-						break
-					}
-					parent_lane++
-				}
+				parent_lane := active_lanes.firstFree(lane)
 				if !active_commits.Exists(parent_hash) && !check_diverge_commit(parent_hash) {
-					active_commits.Delete(active_lanes[parent_lane])
+					active_commits.Delete(active_lanes.get(parent_lane))
 					active_commits.Add(parent_hash)
-					active_lanes[parent_lane] = parent_hash
+					active_lanes.set(parent_lane, parent_hash)
 				}
 			}
 		}
 
-		graphMaxX = utils.Max(graphMaxX, get_max_lanes_no())
+		graphMaxX = utils.Max(graphMaxX, active_lanes.maxOccupied())
 	}
+	active_dummy_commits.finish()
 
 	returned_dummy_commits := make(map[string]Commit)
 	for key, value := range dummy_commits {
@@ -338,8 +326,17 @@ func ActiveLanes(commits_map CommitsMap, children_map ChildrenMap) map[string]Co
 	return returned_dummy_commits
 }
 
+// firstParent is empty for root commits, they stay in their lane after being
+// visited, e.g. the placeholders of a LazyGraph window.
+func firstParent(commit *Commit) string {
+	if len(commit.Parents) == 0 {
+		return ""
+	}
+	return commit.Parents[0]
+}
+
 func AddDummyCommits(commits_map map[string]*Commit, dummy_commits *map[string]Commit) {
-	for key := range *dummy_commits {
+	for _, key := range sortedDummyHashes(*dummy_commits) {
 		dummy_commit := (*dummy_commits)[key]
 		start_commit := commits_map[dummy_commit.Message]
 		end_commit_hash := dummy_commit.Parents[0]
@@ -354,10 +351,67 @@ func AddDummyCommits(commits_map map[string]*Commit, dummy_commits *map[string]C
 	}
 }
 
-func ProcessCommits(commits *map[string]Commit) string {
+// sortedDummyHashes orders dummy hashes by creation, "dummy_100" comes after "dummy_99".
+func sortedDummyHashes[T any](dummy_commits map[string]T) []string {
+	keys := make([]string, 0, len(dummy_commits))
+	for key := range dummy_commits {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) == len(keys[j]) {
+			return keys[i] < keys[j]
+		}
+		return len(keys[i]) < len(keys[j])
+	})
+	return keys
+}
+
+// SortCommits returns commits ordered top to bottom, then left to right.
+func SortCommits(commits_map CommitsMap) []*Commit {
+	sorted_commits := make([]*Commit, 0, len(commits_map))
+	for _, commit := range commits_map {
+		sorted_commits = append(sorted_commits, commit)
+	}
+	sort.Slice(sorted_commits, func(i, j int) bool {
+		if sorted_commits[i].Y_pos != sorted_commits[j].Y_pos {
+			return sorted_commits[i].Y_pos < sorted_commits[j].Y_pos
+		}
+		if sorted_commits[i].X_pos != sorted_commits[j].X_pos {
+			return sorted_commits[i].X_pos < sorted_commits[j].X_pos
+		}
+		return sorted_commits[i].Hash < sorted_commits[j].Hash
+	})
+	return sorted_commits
+}
+
+type Layout struct {
+	Commits CommitsMap
+	MaxX    int
+	MaxY    int
+}
+
+// ComputeLayout assigns X_pos and Y_pos to every commit and adds the dummy
+// commits needed to route merge edges.
+func ComputeLayout(commits *map[string]Commit) Layout {
+	return computeLayout(commits, false, nil, nil)
+}
+
+// ComputeCompactLayout is ComputeLayout with long runs of commits folded into
+// summary nodes by CompactChains, except for the chains in expanded.
+func ComputeCompactLayout(commits *map[string]Commit, expanded map[string]bool) Layout {
+	return computeLayout(commits, true, expanded, nil)
+}
+
+// computeLayout gives the commits in placeholders the last rows, below every
+// other commit, whatever the order.
+func computeLayout(commits *map[string]Commit, compact bool, expanded map[string]bool, placeholders map[string]bool) Layout {
+	layout_mutex.Lock()
+	defer layout_mutex.Unlock()
+
 	commits_map := ComputeCommitsMap(commits)
 	children_map := ComputeChildrenMap(commits)
 
+	graphMaxX = 0
 	graphMaxY = len(*commits)
 
 	root_commits := GetRootCommits(commits_map)
@@ -367,17 +421,55 @@ func ProcessCommits(commits *map[string]Commit) string {
 	logger.Debug(fmt.Sprintf("top commits %v", top_commits))
 
 	generations := ComputeGenerationNumbers(commits_map, top_commits)
+	if compact {
+		CompactChains(commits_map, children_map, expanded)
+		graphMaxY = len(commits_map)
+	}
 
-	UpdateYPositions(commits_map, generations)
+	OrderYPositions(commits_map, children_map, generations, layout_order)
+	if len(placeholders) > 0 {
+		placeLast(commits_map, placeholders)
+	}
 	dummy_commits := ActiveLanes(commits_map, children_map)
 	AddDummyCommits(commits_map, &dummy_commits)
+	graphMaxX = CompactLanes(commits_map)
+	if reduce_crossings {
+		graphMaxX = ReduceCrossings(commits_map)
+	}
 
 	if logger_pkg.IsDebug() {
 		logger.Debug(utils.FormatGraphStructure(commits_map, children_map))
+		logger.Debug(fmt.Sprintf("%d lanes, %d crossings", graphMaxX+1, CountCrossings(commits_map)))
+		if violations := Validate(commits_map); len(violations) > 0 {
+			logger.Debug(fmt.Sprintf("layout violations:\n%s", formatViolations(violations)))
+		}
 	}
 	if utils.SaveCommits() {
 		utils.SaveCommitPositionsToFile(commits_map, "commit_positions.json")
 	}
 
-	return DrawGraph(commits_map, graphMaxX, graphMaxY)
+	return Layout{Commits: commits_map, MaxX: graphMaxX, MaxY: graphMaxY}
+}
+
+// placeLast moves the commits in last below the others, keeping the order of
+// both. The commits moved must not have parents.
+func placeLast(commits_map CommitsMap, last map[string]bool) {
+	sorted_commits := make([]*Commit, 0, len(commits_map))
+	for _, commit := range commits_map {
+		sorted_commits = append(sorted_commits, commit)
+	}
+	sort.Slice(sorted_commits, func(i, j int) bool {
+		if last[sorted_commits[i].Hash] != last[sorted_commits[j].Hash] {
+			return !last[sorted_commits[i].Hash]
+		}
+		return sorted_commits[i].Y_pos < sorted_commits[j].Y_pos
+	})
+	for i, commit := range sorted_commits {
+		commit.Y_pos = i
+	}
+}
+
+func ProcessCommits(commits *map[string]Commit, options RenderOptions) []Line {
+	layout := ComputeLayout(commits)
+	return DrawGraphLines(layout.Commits, layout.MaxX, layout.MaxY, options)
 }
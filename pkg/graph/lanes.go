@@ -0,0 +1,253 @@
+package graph
+
+import (
+	"container/heap"
+	"math/bits"
+	"slices"
+)
+
+// laneIndex holds the commit each lane continues with. Lanes are indexed by
+// that commit and by its first parent, and free lanes are found in a bitset,
+// so no lookup scans every lane.
+type laneIndex struct {
+	commits_map     CommitsMap
+	lanes           []string
+	occupied        []uint64
+	by_hash         map[string][]int
+	by_first_parent map[string][]int
+}
+
+func newLaneIndex(commits_map CommitsMap) *laneIndex {
+	return &laneIndex{
+		commits_map:     commits_map,
+		by_hash:         make(map[string][]int),
+		by_first_parent: make(map[string][]int),
+	}
+}
+
+func (l *laneIndex) get(lane int) string {
+	if lane < len(l.lanes) {
+		return l.lanes[lane]
+	}
+	return ""
+}
+
+// set puts hash in lane, an empty hash frees it.
+func (l *laneIndex) set(lane int, hash string) {
+	for lane >= len(l.lanes) {
+		l.lanes = append(l.lanes, "")
+	}
+	for lane/64 >= len(l.occupied) {
+		l.occupied = append(l.occupied, 0)
+	}
+	if old := l.lanes[lane]; old != "" {
+		removeLane(l.by_hash, old, lane)
+		if first_parent := l.firstParentOf(old); first_parent != "" {
+			removeLane(l.by_first_parent, first_parent, lane)
+		}
+		l.occupied[lane/64] &^= 1 << (lane % 64)
+	}
+	l.lanes[lane] = hash
+	if hash != "" {
+		l.by_hash[hash] = insertSorted(l.by_hash[hash], lane)
+		if first_parent := l.firstParentOf(hash); first_parent != "" {
+			l.by_first_parent[first_parent] = insertSorted(l.by_first_parent[first_parent], lane)
+		}
+		l.occupied[lane/64] |= 1 << (lane % 64)
+	}
+}
+
+// firstParentOf is empty for roots and for commits outside the graph, the
+// lanes they are in are not found by withFirstParent.
+func (l *laneIndex) firstParentOf(hash string) string {
+	if commit, exists := l.commits_map[hash]; exists {
+		return firstParent(commit)
+	}
+	return ""
+}
+
+// firstWith returns the leftmost lane holding hash, or -1.
+func (l *laneIndex) firstWith(hash string) int {
+	if lanes := l.by_hash[hash]; len(lanes) > 0 {
+		return lanes[0]
+	}
+	return -1
+}
+
+// withFirstParent returns the lanes holding a child of hash on its first
+// parent line, from left to right.
+func (l *laneIndex) withFirstParent(hash string) []int {
+	return l.by_first_parent[hash]
+}
+
+// firstFree returns the leftmost free lane not left of from.
+func (l *laneIndex) firstFree(from int) int {
+	for word := from / 64; word < len(l.occupied); word++ {
+		free := ^l.occupied[word]
+		if word == from/64 {
+			free &^= 1<<(from%64) - 1
+		}
+		if free != 0 {
+			return word*64 + bits.TrailingZeros64(free)
+		}
+	}
+	return max(from, len(l.occupied)*64)
+}
+
+// maxOccupied returns the rightmost lane in use, 0 when there is none.
+func (l *laneIndex) maxOccupied() int {
+	for word := len(l.occupied) - 1; word >= 0; word-- {
+		if l.occupied[word] != 0 {
+			return word*64 + 63 - bits.LeadingZeros64(l.occupied[word])
+		}
+	}
+	return 0
+}
+
+func insertSorted(lanes []int, lane int) []int {
+	index, found := slices.BinarySearch(lanes, lane)
+	if found {
+		return lanes
+	}
+	return slices.Insert(lanes, index, lane)
+}
+
+// removeLane drops lane from the lanes of hash, hashes left without lanes
+// are deleted so the index stays as small as the number of lanes.
+func removeLane(index map[string][]int, hash string, lane int) {
+	lanes := index[hash]
+	if position, found := slices.BinarySearch(lanes, lane); found {
+		lanes = slices.Delete(lanes, position, position+1)
+	}
+	if len(lanes) == 0 {
+		delete(index, hash)
+		return
+	}
+	index[hash] = lanes
+}
+
+// dummyLane is a dummy commit while it routes a merge edge. Its X_pos is
+// relative to dummyLanes.shift until it is deactivated.
+type dummyLane struct {
+	commit *Commit
+	end    int
+	active bool
+}
+
+// dummyLanes tracks the active dummy commits in creation order and by the
+// row of the parent they lead to. A collision with a commit moves every
+// active dummy one lane right, which is kept as a shared shift.
+type dummyLanes struct {
+	order   []*dummyLane
+	removed int
+	by_end  map[int][]*dummyLane
+	ends    intHeap
+	by_x    map[int]int
+	max_x   intHeap
+	shift   int
+}
+
+func newDummyLanes() *dummyLanes {
+	return &dummyLanes{by_end: make(map[int][]*dummyLane), by_x: make(map[int]int)}
+}
+
+func (d *dummyLanes) add(commit *Commit, end int) {
+	commit.X_pos -= d.shift
+	dummy := &dummyLane{commit: commit, end: end, active: true}
+	d.order = append(d.order, dummy)
+	if _, exists := d.by_end[end]; !exists {
+		heap.Push(&d.ends, end)
+	}
+	d.by_end[end] = append(d.by_end[end], dummy)
+	d.by_x[commit.X_pos]++
+	heap.Push(&d.max_x, -commit.X_pos)
+}
+
+// x returns the lane of an active dummy.
+func (d *dummyLanes) x(dummy *dummyLane) int {
+	return dummy.commit.X_pos + d.shift
+}
+
+// deactivate fixes the lane of a dummy, it no longer moves on collisions.
+func (d *dummyLanes) deactivate(dummy *dummyLane) {
+	if !dummy.active {
+		return
+	}
+	dummy.active = false
+	d.by_x[dummy.commit.X_pos]--
+	dummy.commit.X_pos += d.shift
+	d.removed++
+	// Compact once most of the order slice is inactive
+	if d.removed > len(d.order)/2 {
+		d.order = slices.DeleteFunc(d.order, func(dummy *dummyLane) bool { return !dummy.active })
+		d.removed = 0
+	}
+}
+
+// expire deactivates the dummies leading to rows above y.
+func (d *dummyLanes) expire(y int) {
+	for d.ends.Len() > 0 && d.ends[0] < y {
+		end := heap.Pop(&d.ends).(int)
+		for _, dummy := range d.by_end[end] {
+			d.deactivate(dummy)
+		}
+		delete(d.by_end, end)
+	}
+}
+
+// endingAt returns the dummies leading to row y in creation order.
+func (d *dummyLanes) endingAt(y int) []*dummyLane {
+	return d.by_end[y]
+}
+
+func (d *dummyLanes) collides(x int) bool {
+	return d.by_x[x-d.shift] > 0
+}
+
+// moveRight moves every active dummy one lane right and returns the
+// rightmost lane of them.
+func (d *dummyLanes) moveRight() int {
+	d.shift++
+	for d.max_x.Len() > 0 && d.by_x[-d.max_x[0]] == 0 {
+		heap.Pop(&d.max_x)
+	}
+	if d.max_x.Len() == 0 {
+		return 0
+	}
+	return -d.max_x[0] + d.shift
+}
+
+// active returns the active dummies in creation order.
+func (d *dummyLanes) active() []*dummyLane {
+	active := make([]*dummyLane, 0, len(d.order)-d.removed)
+	for _, dummy := range d.order {
+		if dummy.active {
+			active = append(active, dummy)
+		}
+	}
+	return active
+}
+
+// finish fixes the lanes of the dummies still active.
+func (d *dummyLanes) finish() {
+	for _, dummy := range d.order {
+		if dummy.active {
+			dummy.active = false
+			dummy.commit.X_pos += d.shift
+		}
+	}
+	d.order = nil
+}
+
+type intHeap []int
+
+func (h intHeap) Len() int           { return len(h) }
+func (h intHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h intHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *intHeap) Push(x any)        { *h = append(*h, x.(int)) }
+func (h *intHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,139 @@
+package graph
+
+import (
+	"sync"
+
+	commit_pkg "git-graph/pkg/commit"
+)
+
+// LazyGraph lays out a commit stream while it is being read. Commits are
+// added as the source produces them and Window lays out only the first ones,
+// twice as many as the previous window each time more rows are needed, so
+// the whole history costs about two full layouts. Windows are not prefixes
+// of each other, rows can move when the next one is laid out.
+type LazyGraph struct {
+	options RenderOptions
+	mutex   sync.Mutex
+	added   *sync.Cond
+	commits []Commit
+	done    bool
+	err     error
+	// Number of commits the cached lines were laid out from
+	laid_out int
+	lines    []Line
+}
+
+func NewLazyGraph(options RenderOptions) *LazyGraph {
+	g := &LazyGraph{options: options}
+	g.added = sync.NewCond(&g.mutex)
+	return g
+}
+
+// NewCompleteGraph wraps a layout computed beforehand, e.g. read from a cache.
+func NewCompleteGraph(layout Layout, options RenderOptions) *LazyGraph {
+	g := NewLazyGraph(options)
+	g.lines = DrawGraphLines(layout.Commits, layout.MaxX, layout.MaxY, options)
+	g.laid_out = len(layout.Commits)
+	g.done = true
+	return g
+}
+
+// Load reads source in the background.
+func (g *LazyGraph) Load(source commit_pkg.CommitSource) {
+	go func() {
+		g.Close(commit_pkg.Stream(source, func(c Commit) error {
+			g.Add(c)
+			return nil
+		}))
+	}()
+}
+
+// Add appends the next commit of the stream.
+func (g *LazyGraph) Add(c Commit) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.commits = append(g.commits, c)
+	g.added.Broadcast()
+}
+
+// Close marks the end of the stream, err is what the source failed with.
+func (g *LazyGraph) Close(err error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.done = true
+	g.err = err
+	g.added.Broadcast()
+}
+
+// Commits waits for the end of the stream and returns every commit read.
+func (g *LazyGraph) Commits() (map[string]Commit, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	for !g.done {
+		g.added.Wait()
+	}
+	if g.err != nil {
+		return nil, g.err
+	}
+	commits := make(map[string]Commit, len(g.commits))
+	for _, c := range g.commits {
+		commits[c.Hash] = c
+	}
+	return commits, nil
+}
+
+// Window returns the lines of a layout of at least the first count commits,
+// waiting for the stream to produce them. complete is set when the lines
+// cover the whole history, they are then the same as ProcessCommits draws.
+func (g *LazyGraph) Window(count int) (lines []Line, complete bool, err error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.lines != nil && (count <= g.laid_out || g.done && g.laid_out >= len(g.commits)) {
+		return g.lines, g.done && g.laid_out >= len(g.commits), g.err
+	}
+	count = max(count, 2*g.laid_out)
+	for len(g.commits) < count && !g.done {
+		g.added.Wait()
+	}
+	if g.err != nil {
+		return nil, false, g.err
+	}
+	count = min(count, len(g.commits))
+	complete = g.done && count == len(g.commits)
+
+	g.lines = layoutWindow(g.commits[:count], complete, g.options)
+	g.laid_out = count
+	return g.lines, complete, nil
+}
+
+// layoutWindow lays out the first commits of a stream. Parents that are not
+// read yet get a placeholder commit so the lanes leading to them are drawn,
+// placeholders have no parents and get the last rows in every order, their
+// rows are cut.
+func layoutWindow(commits []Commit, complete bool, options RenderOptions) []Line {
+	window := make(map[string]Commit, len(commits))
+	for _, c := range commits {
+		window[c.Hash] = c
+	}
+	if complete {
+		return ProcessCommits(&window, options)
+	}
+
+	placeholders := make(map[string]bool)
+	for _, c := range commits {
+		for _, parent_hash := range c.Parents {
+			if _, exists := window[parent_hash]; !exists {
+				window[parent_hash] = Commit{Hash: parent_hash, Parents: []string{}}
+				placeholders[parent_hash] = true
+			}
+		}
+	}
+
+	layout := computeLayout(&window, false, nil, placeholders)
+	lines := DrawGraphLines(layout.Commits, layout.MaxX, layout.MaxY, options)
+	if len(placeholders) == 0 {
+		return lines
+	}
+	return lines[:len(commits)*options.withDefaults().YSpacing]
+}
@@ -0,0 +1,176 @@
+package graph
+
+import (
+	"slices"
+	"sort"
+	"testing"
+
+	color "git-graph/pkg/color"
+	commit_pkg "git-graph/pkg/commit"
+)
+
+func TestLazyGraphWindows(t *testing.T) {
+	source := fixtureSource("many-merges-readable")
+	commits, err := source.Commits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := DefaultRenderOptions()
+	options.Color = color.NoColor
+
+	g := NewLazyGraph(options)
+	streamed := make([]string, 0, len(commits))
+	err = commit_pkg.Stream(source, func(c Commit) error {
+		g.Add(c)
+		streamed = append(streamed, c.Hash)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines, complete, err := g.Window(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if complete {
+		t.Error("a window of 5 commits should not be complete")
+	}
+	shown := 0
+	for _, line := range lines {
+		if line.Hash == "" {
+			continue
+		}
+		shown++
+		if !slices.Contains(streamed[:5], line.Hash) {
+			t.Errorf("commit %s is not one of the first 5 commits", line.Hash[:8])
+		}
+	}
+	if shown != 5 {
+		t.Errorf("expected 5 commits in the window, got %d", shown)
+	}
+
+	// The next window doubles the number of laid out commits
+	lines, _, _ = g.Window(6)
+	shown = 0
+	for _, line := range lines {
+		if line.Hash != "" {
+			shown++
+		}
+	}
+	if shown != 10 {
+		t.Errorf("expected 10 commits in the second window, got %d", shown)
+	}
+
+	g.Close(nil)
+	lines, complete, err = g.Window(len(commits))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !complete {
+		t.Error("a window of every commit should be complete")
+	}
+	expected := ProcessCommits(&commits, options)
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, got %d", len(expected), len(lines))
+	}
+	for i := range lines {
+		if lines[i].String() != expected[i].String() {
+			t.Errorf("line %d: expected %q, got %q", i, expected[i].String(), lines[i].String())
+		}
+	}
+}
+
+// Every window is laid out again from scratch: it shows the first commits of
+// the stream, each above its parents, but the rows of the previous window
+// are not kept, commits read later can be placed between them.
+func TestLazyGraphReflow(t *testing.T) {
+	commits := syntheticHistory(1000, 16)
+	streamed := make([]Commit, 0, len(commits))
+	for _, c := range commits {
+		streamed = append(streamed, c)
+	}
+	sort.Slice(streamed, func(i, j int) bool { return streamed[i].Y_pos < streamed[j].Y_pos })
+	options := DefaultRenderOptions()
+	options.Color = color.NoColor
+	g := NewLazyGraph(options)
+	for _, c := range streamed {
+		g.Add(c)
+	}
+	g.Close(nil)
+
+	previous := []string{}
+	reordered := false
+	for count := 8; ; count *= 2 {
+		lines, complete, err := g.Window(count)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows := []string{}
+		row_of := make(map[string]int)
+		for _, line := range lines {
+			if line.Hash != "" {
+				row_of[line.Hash] = len(rows)
+				rows = append(rows, line.Hash)
+			}
+		}
+		if len(rows) != min(count, len(streamed)) {
+			t.Fatalf("window of %d: expected %d commits, got %d", count, min(count, len(streamed)), len(rows))
+		}
+		for _, c := range streamed[:len(rows)] {
+			row, exists := row_of[c.Hash]
+			if !exists {
+				t.Fatalf("window of %d: commit %s read early is missing", count, c.Hash[:8])
+			}
+			for _, parent_hash := range c.Parents {
+				if parent_row, exists := row_of[parent_hash]; exists && parent_row <= row {
+					t.Errorf("window of %d: commit %s is not above its parent %s", count, c.Hash[:8], parent_hash[:8])
+				}
+			}
+		}
+		reordered = reordered || !slices.Equal(rows[:len(previous)], previous)
+		previous = rows
+		if complete {
+			break
+		}
+	}
+	if !reordered {
+		t.Error("expected rows to move between windows, update the documentation if they no longer do")
+	}
+}
+
+// Placeholders for the parents not read yet are placed below every commit
+// read, whatever the order, so a window shows all of them
+func TestLazyGraphWindowOrders(t *testing.T) {
+	commits := syntheticHistory(3000, 16)
+	streamed := make([]Commit, 0, len(commits))
+	for _, c := range commits {
+		streamed = append(streamed, c)
+	}
+	sort.Slice(streamed, func(i, j int) bool { return streamed[i].Y_pos < streamed[j].Y_pos })
+	options := DefaultRenderOptions()
+	options.Color = color.NoColor
+
+	defer SetOrder(OrderDefault)
+	for name, order := range ORDERS {
+		SetOrder(order)
+		g := NewLazyGraph(options)
+		for _, c := range streamed {
+			g.Add(c)
+		}
+		g.Close(nil)
+		lines, _, err := g.Window(200)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shown := 0
+		for _, line := range lines {
+			if line.Hash != "" {
+				shown++
+			}
+		}
+		if shown != 200 {
+			t.Errorf("%s order: expected 200 commits in the window, got %d", name, shown)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package graph
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+)
+
+// Order is the strategy giving commits their row. Every strategy shows
+// children above their parents.
+type Order int
+
+const (
+	// Generation numbers, then parent count and commit date
+	OrderDefault Order = iota
+	// Like git log --topo-order, the commits of a merged branch follow the merge
+	OrderTopo
+	// Like git log --date-order and --author-date-order
+	OrderDate
+	OrderAuthorDate
+	// Each first-parent chain is kept together, merged branches come after it
+	OrderLaneStable
+)
+
+var ORDERS = map[string]Order{
+	"default":     OrderDefault,
+	"topo":        OrderTopo,
+	"date":        OrderDate,
+	"author-date": OrderAuthorDate,
+	"lane-stable": OrderLaneStable,
+}
+
+func OrderByName(name string) (Order, error) {
+	order, exists := ORDERS[name]
+	if !exists {
+		return OrderDefault, fmt.Errorf("unknown order %q, expected one of: default, topo, date, author-date, lane-stable", name)
+	}
+	return order, nil
+}
+
+// Order used by every layout computed afterwards
+var layout_order = OrderDefault
+
+func SetOrder(order Order) {
+	layout_mutex.Lock()
+	defer layout_mutex.Unlock()
+	layout_order = order
+}
+
+// OrderYPositions sets Y_pos following order, GenerationNumber is set as
+// UpdateYPositions does.
+func OrderYPositions(commits_map CommitsMap, children_map ChildrenMap, generation_numbers map[string]int, order Order) {
+	if order == OrderDefault {
+		UpdateYPositions(commits_map, generation_numbers)
+		return
+	}
+	max_generation := 0
+	for _, generation_number := range generation_numbers {
+		max_generation = max(max_generation, generation_number)
+	}
+	for _, commit := range commits_map {
+		commit.GenerationNumber = max_generation - generation_numbers[commit.Hash]
+	}
+
+	var sorted_commits []*Commit
+	switch order {
+	case OrderTopo:
+		sorted_commits = topoOrder(commits_map, children_map, false)
+	case OrderLaneStable:
+		sorted_commits = topoOrder(commits_map, children_map, true)
+	case OrderDate:
+		sorted_commits = dateOrder(commits_map, children_map, Commit.CommitterTimestamp)
+	case OrderAuthorDate:
+		sorted_commits = dateOrder(commits_map, children_map, func(c Commit) uint64 { return c.Timestamp })
+	}
+	for i, commit := range sorted_commits {
+		commit.Y_pos = i
+	}
+}
+
+// pendingChildren counts the children of every commit, a commit is shown once
+// all of them are.
+func pendingChildren(commits_map CommitsMap, children_map ChildrenMap) map[string]int {
+	pending := make(map[string]int, len(commits_map))
+	for hash := range commits_map {
+		for _, child_hash := range children_map[hash] {
+			if _, exists := commits_map[child_hash]; exists {
+				pending[hash]++
+			}
+		}
+	}
+	return pending
+}
+
+// newerFirst orders by commit date, newest first, then by hash.
+func newerFirst(c1, c2 *Commit) bool {
+	if c1.CommitterTimestamp() == c2.CommitterTimestamp() {
+		return c1.Hash < c2.Hash
+	}
+	return c1.CommitterTimestamp() > c2.CommitterTimestamp()
+}
+
+// topoOrder walks from the tips, newest first, and goes on with the parents
+// of the commit just shown once they are ready. Like git, the last parent is
+// taken first, so a merged branch follows its merge; with first_parent_first
+// the first parent is, so the chain of a branch is not broken.
+func topoOrder(commits_map CommitsMap, children_map ChildrenMap, first_parent_first bool) []*Commit {
+	pending := pendingChildren(commits_map, children_map)
+	stack := make([]*Commit, 0)
+	for hash, commit := range commits_map {
+		if pending[hash] == 0 {
+			stack = append(stack, commit)
+		}
+	}
+	// The top of the stack is taken first
+	sort.Slice(stack, func(i, j int) bool { return newerFirst(stack[j], stack[i]) })
+
+	sorted_commits := make([]*Commit, 0, len(commits_map))
+	for len(stack) > 0 {
+		commit := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		sorted_commits = append(sorted_commits, commit)
+		for i := range commit.Parents {
+			parent_hash := commit.Parents[i]
+			if first_parent_first {
+				parent_hash = commit.Parents[len(commit.Parents)-1-i]
+			}
+			parent, exists := commits_map[parent_hash]
+			if !exists {
+				continue
+			}
+			pending[parent_hash]--
+			if pending[parent_hash] == 0 {
+				stack = append(stack, parent)
+			}
+		}
+	}
+	return sorted_commits
+}
+
+// readyCommits is the heap of commits whose children are all shown, the one
+// with the latest timestamp on top.
+type readyCommits struct {
+	commits   []*Commit
+	timestamp func(Commit) uint64
+}
+
+func (r readyCommits) Len() int { return len(r.commits) }
+func (r readyCommits) Less(i, j int) bool {
+	t1, t2 := r.timestamp(*r.commits[i]), r.timestamp(*r.commits[j])
+	if t1 == t2 {
+		return r.commits[i].Hash < r.commits[j].Hash
+	}
+	return t1 > t2
+}
+func (r readyCommits) Swap(i, j int) { r.commits[i], r.commits[j] = r.commits[j], r.commits[i] }
+func (r *readyCommits) Push(x any)   { r.commits = append(r.commits, x.(*Commit)) }
+func (r *readyCommits) Pop() any {
+	last := r.commits[len(r.commits)-1]
+	r.commits = r.commits[:len(r.commits)-1]
+	return last
+}
+
+// dateOrder shows the newest commit whose children are all shown first.
+func dateOrder(commits_map CommitsMap, children_map ChildrenMap, timestamp func(Commit) uint64) []*Commit {
+	pending := pendingChildren(commits_map, children_map)
+	ready := &readyCommits{timestamp: timestamp}
+	for hash, commit := range commits_map {
+		if pending[hash] == 0 {
+			ready.commits = append(ready.commits, commit)
+		}
+	}
+	heap.Init(ready)
+
+	sorted_commits := make([]*Commit, 0, len(commits_map))
+	for ready.Len() > 0 {
+		commit := heap.Pop(ready).(*Commit)
+		sorted_commits = append(sorted_commits, commit)
+		for _, parent_hash := range commit.Parents {
+			parent, exists := commits_map[parent_hash]
+			if !exists {
+				continue
+			}
+			pending[parent_hash]--
+			if pending[parent_hash] == 0 {
+				heap.Push(ready, parent)
+			}
+		}
+	}
+	return sorted_commits
+}
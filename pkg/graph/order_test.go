@@ -0,0 +1,82 @@
+package graph
+
+import (
+	"slices"
+	"testing"
+
+	commit_pkg "git-graph/pkg/commit"
+)
+
+func TestOrders(t *testing.T) {
+	// a - b ------ m - c (main)
+	//  \          /
+	//   f1 ---- f2 (feature)
+	// Commit dates interleave the branches: a, f1, b, f2, m, c
+	commits, err := commit_pkg.NewBuilder().
+		Add("aaaaaaaa", "a").
+		Add("f1f1f1f1", "f1", "aaaaaaaa").
+		Add("bbbbbbbb", "b", "aaaaaaaa").
+		Add("f2f2f2f2", "f2", "f1f1f1f1").
+		Add("mmmmmmmm", "merge feature", "bbbbbbbb", "f2f2f2f2").
+		Add("cccccccc", "c", "mmmmmmmm").
+		Refs("cccccccc", "HEAD -> main").
+		Commits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SetOrder(OrderDefault)
+
+	expected := map[string][]string{
+		"date":        {"cc", "mm", "f2", "bb", "f1", "aa"},
+		"topo":        {"cc", "mm", "f2", "f1", "bb", "aa"},
+		"lane-stable": {"cc", "mm", "bb", "f2", "f1", "aa"},
+	}
+	for name, rows := range expected {
+		order, err := OrderByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		SetOrder(order)
+		layout := ComputeLayout(&commits)
+		shown := []string{}
+		for _, commit := range SortCommits(layout.Commits) {
+			if _, exists := commits[commit.Hash]; exists {
+				shown = append(shown, commit.Hash[:2])
+			}
+		}
+		if !slices.Equal(shown, rows) {
+			t.Errorf("%s: expected rows %v, got %v", name, rows, shown)
+		}
+	}
+
+	if _, err := OrderByName("random"); err == nil {
+		t.Error("expected an error for an unknown order")
+	}
+}
+
+// Every order shows children above their parents, the rest of the layout is
+// up to ActiveLanes
+func TestOrdersTopological(t *testing.T) {
+	for name, order := range ORDERS {
+		for _, s := range synthetic_scenarios {
+			commits := loadFixture(t, s.name)
+			commits_map := ComputeCommitsMap(&commits)
+			children_map := ComputeChildrenMap(&commits)
+			generations := ComputeGenerationNumbers(commits_map, GetTopCommits(commits_map, children_map))
+			OrderYPositions(commits_map, children_map, generations, order)
+
+			rows := make([]bool, len(commits_map))
+			for _, commit := range commits_map {
+				if commit.Y_pos < 0 || commit.Y_pos >= len(rows) || rows[commit.Y_pos] {
+					t.Fatalf("%s order of %s: %s has row %d", name, s.name, commit.Hash[:8], commit.Y_pos)
+				}
+				rows[commit.Y_pos] = true
+			}
+			for _, violation := range Validate(commits_map) {
+				if violation.Kind == ParentAboveChild {
+					t.Errorf("%s order of %s: %s", name, s.name, violation)
+				}
+			}
+		}
+	}
+}
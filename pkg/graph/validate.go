@@ -0,0 +1,155 @@
+package graph
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+type ViolationKind string
+
+const (
+	OverlappingCommits ViolationKind = "overlapping-commits"
+	EdgeThroughCommit  ViolationKind = "edge-through-commit"
+	ParentAboveChild   ViolationKind = "parent-above-child"
+	DetachedMergeEdge  ViolationKind = "detached-merge-edge"
+	DanglingDummy      ViolationKind = "dangling-dummy"
+)
+
+// Violation describes a layout problem found by Validate. Commits lists the
+// hashes involved, X and Y locate the offending cell in commit coordinates.
+type Violation struct {
+	Kind    ViolationKind
+	Commits []string
+	X       int
+	Y       int
+}
+
+func (v Violation) String() string {
+	hashes := make([]string, len(v.Commits))
+	for i, hash := range v.Commits {
+		hashes[i] = shortHash(hash)
+	}
+	return fmt.Sprintf("%s at X=%d Y=%d: %s", v.Kind, v.X, v.Y, strings.Join(hashes, ", "))
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 8 {
+		return hash[:8]
+	}
+	return hash
+}
+
+func isDummyCommit(commit *Commit) bool {
+	return strings.HasPrefix(commit.Hash, "dummy_")
+}
+
+type cell struct {
+	x int
+	y int
+}
+
+// Validate checks the positions computed by the layout against the rules
+// DrawGraph relies on. It must run after AddDummyCommits.
+func Validate(commits_map CommitsMap) []Violation {
+	violations := make([]Violation, 0)
+	sorted_commits := SortCommits(commits_map)
+
+	cells := make(map[cell][]string)
+	for _, commit := range sorted_commits {
+		position := cell{commit.X_pos, commit.Y_pos}
+		cells[position] = append(cells[position], commit.Hash)
+	}
+	for _, commit := range sorted_commits {
+		position := cell{commit.X_pos, commit.Y_pos}
+		if hashes := cells[position]; len(hashes) > 1 && hashes[0] == commit.Hash {
+			violations = append(violations, Violation{OverlappingCommits, hashes, position.x, position.y})
+		}
+	}
+
+	children_map := make(ChildrenMap)
+	for _, commit := range sorted_commits {
+		for _, parent_hash := range commit.Parents {
+			children_map[parent_hash] = append(children_map[parent_hash], commit.Hash)
+		}
+	}
+
+	for _, commit := range sorted_commits {
+		if isDummyCommit(commit) {
+			violations = append(violations, validateDummy(commits_map, commit)...)
+		}
+
+		for parent_no, parent_hash := range commit.Parents {
+			parent, exists := commits_map[parent_hash]
+			if !exists {
+				continue
+			}
+			if parent.Y_pos <= commit.Y_pos {
+				violations = append(violations, Violation{ParentAboveChild, []string{commit.Hash, parent.Hash}, parent.X_pos, parent.Y_pos})
+				continue
+			}
+
+			x_distance := parent.X_pos - commit.X_pos
+			column := commit.X_pos
+			if x_distance > 0 {
+				column = parent.X_pos
+			} else if x_distance < 0 && len(commit.Parents) > 1 && parent_no != 0 {
+				// Merges to the left are drawn as a single horizontal line, which
+				// must land on the parent itself or on a lane already going there
+				if parent.Y_pos != commit.Y_pos+1 && !hasLaneTo(commits_map, children_map, commit, parent) {
+					violations = append(violations, Violation{DetachedMergeEdge, []string{commit.Hash, parent.Hash}, commit.X_pos, commit.Y_pos})
+				}
+				continue
+			}
+
+			for y := commit.Y_pos + 1; y < parent.Y_pos; y++ {
+				for _, hash := range cells[cell{column, y}] {
+					// Dummy commits going to the same parent share the lane
+					if node := commits_map[hash]; isDummyCommit(node) && slices.Contains(node.Parents, parent.Hash) {
+						continue
+					}
+					violations = append(violations, Violation{EdgeThroughCommit, []string{commit.Hash, parent.Hash, hash}, column, y})
+				}
+			}
+		}
+	}
+	return violations
+}
+
+// hasLaneTo reports whether another child of parent already draws a vertical
+// line in the parent's column at the row where commit merges into it. Edges
+// from children in the same or a lower column always go down in that column.
+func hasLaneTo(commits_map CommitsMap, children_map ChildrenMap, commit, parent *Commit) bool {
+	for _, child_hash := range children_map[parent.Hash] {
+		child := commits_map[child_hash]
+		if child.Hash != commit.Hash && child.Y_pos <= commit.Y_pos && child.X_pos <= parent.X_pos {
+			return true
+		}
+	}
+	return false
+}
+
+func validateDummy(commits_map CommitsMap, dummy *Commit) []Violation {
+	dangling := Violation{DanglingDummy, []string{dummy.Hash}, dummy.X_pos, dummy.Y_pos}
+	if len(dummy.Parents) != 1 {
+		return []Violation{dangling}
+	}
+	if _, exists := commits_map[dummy.Parents[0]]; !exists {
+		return []Violation{dangling}
+	}
+	start_commit, exists := commits_map[dummy.Message]
+	if !exists || !slices.Contains(start_commit.Parents, dummy.Hash) {
+		return []Violation{dangling}
+	}
+	return nil
+}
+
+func formatViolations(violations []Violation) string {
+	lines := make([]string, len(violations))
+	for i, violation := range violations {
+		lines[i] = violation.String()
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,100 @@
+package graph
+
+import (
+	"testing"
+)
+
+func layoutOf(commits ...Commit) CommitsMap {
+	commits_map := make(CommitsMap)
+	for i := range commits {
+		if commits[i].Parents == nil {
+			commits[i].Parents = []string{}
+		}
+		commits_map[commits[i].Hash] = &commits[i]
+	}
+	return commits_map
+}
+
+func violationKinds(violations []Violation) []ViolationKind {
+	kinds := make([]ViolationKind, len(violations))
+	for i, violation := range violations {
+		kinds[i] = violation.Kind
+	}
+	return kinds
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name     string
+		commits  CommitsMap
+		expected []ViolationKind
+	}{
+		{
+			name: "valid branch",
+			commits: layoutOf(
+				Commit{Hash: "cccccccc", Parents: []string{"aaaaaaaa"}, X_pos: 1, Y_pos: 0},
+				Commit{Hash: "bbbbbbbb", Parents: []string{"aaaaaaaa"}, X_pos: 0, Y_pos: 1},
+				Commit{Hash: "aaaaaaaa", X_pos: 0, Y_pos: 2},
+			),
+			expected: []ViolationKind{},
+		},
+		{
+			name: "shared cell",
+			commits: layoutOf(
+				Commit{Hash: "bbbbbbbb", X_pos: 0, Y_pos: 0},
+				Commit{Hash: "aaaaaaaa", X_pos: 0, Y_pos: 0},
+			),
+			expected: []ViolationKind{OverlappingCommits},
+		},
+		{
+			name: "parent above child",
+			commits: layoutOf(
+				Commit{Hash: "aaaaaaaa", X_pos: 0, Y_pos: 0},
+				Commit{Hash: "bbbbbbbb", Parents: []string{"aaaaaaaa"}, X_pos: 0, Y_pos: 1},
+			),
+			expected: []ViolationKind{ParentAboveChild},
+		},
+		{
+			name: "edge through commit",
+			commits: layoutOf(
+				Commit{Hash: "cccccccc", Parents: []string{"aaaaaaaa"}, X_pos: 0, Y_pos: 0},
+				Commit{Hash: "bbbbbbbb", X_pos: 0, Y_pos: 1},
+				Commit{Hash: "aaaaaaaa", X_pos: 0, Y_pos: 2},
+			),
+			expected: []ViolationKind{EdgeThroughCommit},
+		},
+		{
+			name: "detached merge edge",
+			commits: layoutOf(
+				Commit{Hash: "dddddddd", Parents: []string{"cccccccc", "aaaaaaaa"}, X_pos: 1, Y_pos: 0},
+				Commit{Hash: "cccccccc", Parents: []string{"bbbbbbbb"}, X_pos: 1, Y_pos: 1},
+				Commit{Hash: "bbbbbbbb", X_pos: 1, Y_pos: 2},
+				Commit{Hash: "aaaaaaaa", X_pos: 0, Y_pos: 3},
+			),
+			expected: []ViolationKind{DetachedMergeEdge},
+		},
+		{
+			name: "dangling dummy",
+			commits: layoutOf(
+				Commit{Hash: "bbbbbbbb", Parents: []string{"aaaaaaaa"}, X_pos: 0, Y_pos: 0},
+				Commit{Hash: "dummy_00", Message: "bbbbbbbb", Parents: []string{"aaaaaaaa"}, X_pos: 1, Y_pos: 1},
+				Commit{Hash: "aaaaaaaa", X_pos: 0, Y_pos: 2},
+			),
+			expected: []ViolationKind{DanglingDummy},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			kinds := violationKinds(Validate(c.commits))
+			if len(kinds) != len(c.expected) {
+				t.Fatalf("expected %v, got %v", c.expected, kinds)
+			}
+			for i := range kinds {
+				if kinds[i] != c.expected[i] {
+					t.Fatalf("expected %v, got %v", c.expected, kinds)
+				}
+			}
+		})
+	}
+}
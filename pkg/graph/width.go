@@ -0,0 +1,347 @@
+package graph
+
+import (
+	"slices"
+	"sort"
+)
+
+// edgeSpan is where DrawGraphLines draws the edge from commit to parent, in
+// half rows: 2*Y_pos is the row of a commit and 2*Y_pos+1 the row its edges
+// turn on. The vertical part is in the column of owner from top to bottom,
+// none when top > bottom, and the horizontal part is on row turn between the
+// columns of both ends, none for straight edges.
+type edgeSpan struct {
+	commit *Commit
+	parent *Commit
+	owner  *Commit
+	top    int
+	bottom int
+	turn   int
+}
+
+const no_turn = -1
+
+func edgeSpans(commits_map CommitsMap) []edgeSpan {
+	spans := make([]edgeSpan, 0, len(commits_map))
+	for _, commit := range SortCommits(commits_map) {
+		for parent_no, parent_hash := range commit.Parents {
+			parent, exists := commits_map[parent_hash]
+			if !exists {
+				continue
+			}
+			commit_row, parent_row := 2*commit.Y_pos, 2*parent.Y_pos
+			span := edgeSpan{commit: commit, parent: parent}
+			switch {
+			case parent.X_pos == commit.X_pos:
+				span.owner, span.top, span.bottom, span.turn = commit, commit_row, parent_row, no_turn
+			case parent.X_pos > commit.X_pos:
+				span.owner, span.top, span.bottom, span.turn = parent, commit_row+1, parent_row, commit_row+1
+			case len(commit.Parents) > 1 && parent_no > 0:
+				// Merges to the left only draw the horizontal part
+				span.owner, span.top, span.bottom, span.turn = commit, commit_row+1, commit_row, commit_row+1
+			default:
+				span.owner, span.top, span.bottom, span.turn = commit, commit_row, parent_row-1, parent_row-1
+			}
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+// laneUnit is a set of commits drawn in one column: commits joined by a
+// vertical edge, and the ones of their column sharing a half row with them.
+// Units spanning a common half row must stay in different columns.
+type laneUnit struct {
+	x       int
+	top     int
+	bottom  int
+	commits []*Commit
+}
+
+// laneUnits returns the units of a layout ordered by column and top row, with
+// the unit of every commit, and the number of half rows.
+func laneUnits(commits_map CommitsMap, spans []edgeSpan) ([]*laneUnit, map[string]int, int) {
+	index := make(map[*Commit]int, len(commits_map))
+	commits := make([]*Commit, 0, len(commits_map))
+	for _, commit := range commits_map {
+		index[commit] = len(commits)
+		commits = append(commits, commit)
+	}
+	roots := make([]int, len(commits))
+	find := func(i int) int {
+		for roots[i] != i {
+			roots[i] = roots[roots[i]]
+			i = roots[i]
+		}
+		return i
+	}
+	top := make([]int, len(commits))
+	bottom := make([]int, len(commits))
+	extend := func(commit *Commit, from, to int) {
+		i := index[commit]
+		top[i] = min(top[i], from)
+		bottom[i] = max(bottom[i], to)
+	}
+	max_y := 0
+	for i, commit := range commits {
+		roots[i] = i
+		top[i], bottom[i] = 2*commit.Y_pos, 2*commit.Y_pos
+		max_y = max(max_y, commit.Y_pos)
+	}
+	for _, span := range spans {
+		if span.top <= span.bottom {
+			extend(span.owner, span.top, span.bottom)
+		}
+		if span.turn != no_turn {
+			extend(span.commit, span.turn, span.turn)
+			extend(span.parent, span.turn, span.turn)
+		} else {
+			roots[find(index[span.commit])] = find(index[span.parent])
+		}
+	}
+
+	units_by_root := make([]*laneUnit, len(commits))
+	units := []*laneUnit{}
+	for i, commit := range commits {
+		root := find(i)
+		unit := units_by_root[root]
+		if unit == nil {
+			unit = &laneUnit{x: commit.X_pos, top: top[i], bottom: bottom[i]}
+			units_by_root[root] = unit
+			units = append(units, unit)
+		}
+		unit.top = min(unit.top, top[i])
+		unit.bottom = max(unit.bottom, bottom[i])
+		unit.commits = append(unit.commits, commit)
+	}
+	for _, unit := range units {
+		sort.Slice(unit.commits, func(i, j int) bool { return unit.commits[i].Hash < unit.commits[j].Hash })
+	}
+	sort.Slice(units, func(i, j int) bool {
+		if units[i].x != units[j].x {
+			return units[i].x < units[j].x
+		}
+		if units[i].top != units[j].top {
+			return units[i].top < units[j].top
+		}
+		return units[i].commits[0].Hash < units[j].commits[0].Hash
+	})
+	// Units of a column sharing a row are drawn as one line there, e.g. a
+	// lane ending on the row the next one starts on, they move together
+	merged := units[:1]
+	for _, unit := range units[1:] {
+		last := merged[len(merged)-1]
+		if last.x == unit.x && unit.top <= last.bottom {
+			last.bottom = max(last.bottom, unit.bottom)
+			last.commits = append(last.commits, unit.commits...)
+			continue
+		}
+		merged = append(merged, unit)
+	}
+
+	unit_of := make(map[string]int, len(commits_map))
+	for i, unit := range merged {
+		for _, commit := range unit.commits {
+			unit_of[commit.Hash] = i
+		}
+	}
+	return merged, unit_of, 2*max_y + 2
+}
+
+// placeUnits puts each unit, in the order given, in the first column right
+// of the units already placed on its rows. It returns the columns by unit and
+// the largest one.
+func placeUnits(units []*laneUnit, order []int, rows int) ([]int, int) {
+	placed := newMaxTree(rows)
+	columns := make([]int, len(units))
+	max_x := 0
+	for _, i := range order {
+		columns[i] = placed.query(units[i].top, units[i].bottom) + 1
+		placed.update(units[i].top, units[i].bottom, columns[i])
+		max_x = max(max_x, columns[i])
+	}
+	return columns, max_x
+}
+
+func moveUnits(units []*laneUnit, columns []int) {
+	for i, unit := range units {
+		for _, commit := range unit.commits {
+			commit.X_pos = columns[i]
+		}
+	}
+}
+
+func maxLane(commits_map CommitsMap) int {
+	max_x := 0
+	for _, commit := range commits_map {
+		max_x = max(max_x, commit.X_pos)
+	}
+	return max_x
+}
+
+// CompactLanes moves units left into columns free on their rows and the half
+// rows around them, so lanes ActiveLanes left apart share a column. A move
+// keeps the two ends of every edge on their sides and is kept only when it
+// adds no crossing and no violation. It returns the largest X_pos.
+func CompactLanes(commits_map CommitsMap) int {
+	if len(commits_map) == 0 {
+		return maxLane(commits_map)
+	}
+	spans := edgeSpans(commits_map)
+	units, unit_of, _ := laneUnits(commits_map, spans)
+
+	// The units an edge joins to the left of each unit
+	left_of := make([][]int, len(units))
+	for _, span := range spans {
+		from, to := unit_of[span.commit.Hash], unit_of[span.parent.Hash]
+		if from == to {
+			continue
+		}
+		if span.commit.X_pos < span.parent.X_pos {
+			from, to = to, from
+		}
+		left_of[from] = append(left_of[from], to)
+	}
+	// Units of every column by top row, they do not share half rows
+	by_column := map[int][]*laneUnit{}
+	for _, unit := range units {
+		by_column[unit.x] = append(by_column[unit.x], unit)
+	}
+	free := func(x int, unit *laneUnit) bool {
+		column := by_column[x]
+		i := sort.Search(len(column), func(i int) bool { return column[i].top > unit.bottom+1 })
+		return i == 0 || column[i-1].bottom < unit.top-1
+	}
+
+	crossings, violations := -1, -1
+	for i, unit := range units {
+		from := 0
+		for _, left := range left_of[i] {
+			from = max(from, units[left].x+1)
+		}
+		for x := from; x < unit.x; x++ {
+			if !free(x, unit) {
+				continue
+			}
+			if crossings < 0 {
+				crossings, violations = CountCrossings(commits_map), len(Validate(commits_map))
+			}
+			old_x := unit.x
+			moveUnit(unit, x)
+			new_crossings, new_violations := CountCrossings(commits_map), len(Validate(commits_map))
+			if new_crossings > crossings || new_violations > violations {
+				moveUnit(unit, old_x)
+				continue
+			}
+			crossings, violations = new_crossings, new_violations
+			by_column[old_x] = slices.DeleteFunc(by_column[old_x], func(other *laneUnit) bool { return other == unit })
+			column := by_column[x]
+			at := sort.Search(len(column), func(i int) bool { return column[i].top > unit.top })
+			by_column[x] = slices.Insert(column, at, unit)
+			break
+		}
+	}
+	return maxLane(commits_map)
+}
+
+func moveUnit(unit *laneUnit, x int) {
+	unit.x = x
+	for _, commit := range unit.commits {
+		commit.X_pos = x
+	}
+}
+
+// maxTree keeps the largest lane placed on every half row, -1 when empty.
+// Updates only raise values, so tags are never pushed down.
+type maxTree struct {
+	size  int
+	value []int
+	tag   []int
+}
+
+func newMaxTree(size int) *maxTree {
+	t := &maxTree{size: size, value: make([]int, 4*size), tag: make([]int, 4*size)}
+	for i := range t.value {
+		t.value[i], t.tag[i] = -1, -1
+	}
+	return t
+}
+
+func (t *maxTree) update(from, to, x int) {
+	t.updateNode(1, 0, t.size-1, from, to, x)
+}
+
+func (t *maxTree) updateNode(node, low, high, from, to, x int) {
+	if to < low || high < from {
+		return
+	}
+	t.value[node] = max(t.value[node], x)
+	if from <= low && high <= to {
+		t.tag[node] = max(t.tag[node], x)
+		return
+	}
+	middle := (low + high) / 2
+	t.updateNode(2*node, low, middle, from, to, x)
+	t.updateNode(2*node+1, middle+1, high, from, to, x)
+}
+
+func (t *maxTree) query(from, to int) int {
+	return t.queryNode(1, 0, t.size-1, from, to)
+}
+
+func (t *maxTree) queryNode(node, low, high, from, to int) int {
+	if to < low || high < from {
+		return -1
+	}
+	if from <= low && high <= to {
+		return t.value[node]
+	}
+	middle := (low + high) / 2
+	return max(t.tag[node], t.queryNode(2*node, low, middle, from, to), t.queryNode(2*node+1, middle+1, high, from, to))
+}
+
+// lanesByUse copies the commits with the lanes past the first kept ones
+// sorted by use, the half rows their lines cover: the least used lanes go
+// right, and every group keeps its order. Ties keep the leftmost lane.
+func lanesByUse(commits_map CommitsMap, max_x int, kept int) CommitsMap {
+	used := make([]int, max_x+1)
+	units, _, _ := laneUnits(commits_map, edgeSpans(commits_map))
+	for _, unit := range units {
+		used[unit.x] += unit.bottom - unit.top + 1
+	}
+	lanes := make([]int, max_x+1)
+	for x := range lanes {
+		lanes[x] = x
+	}
+	sort.SliceStable(lanes, func(i, j int) bool { return used[lanes[i]] > used[lanes[j]] })
+	slices.Sort(lanes[:kept])
+	slices.Sort(lanes[kept:])
+	columns := make([]int, max_x+1)
+	for column, x := range lanes {
+		columns[x] = column
+	}
+
+	moved := make(CommitsMap, len(commits_map))
+	for hash, commit := range commits_map {
+		copied := *commit
+		copied.X_pos = columns[commit.X_pos]
+		moved[hash] = &copied
+	}
+	return moved
+}
+
+// foldLanes draws the lanes from overflow_lane on as a single lane: the
+// glyph of a commit in one of them, otherwise OVERFLOW where any of them has
+// a line. DrawGraphLines moves the least used lanes there with lanesByUse.
+func foldLanes(grid [][]gridCell, commits map[int]*Commit, overflow_lane int, x_spacing int) {
+	start := overflow_lane * x_spacing
+	for y, row := range grid {
+		folded := gridCell{BLANK, overflow_lane}
+		if commit, exists := commits[y]; exists && commit.X_pos >= overflow_lane {
+			folded = row[commit.X_pos*x_spacing]
+		} else if slices.ContainsFunc(row[start:], func(cell gridCell) bool { return cell.glyph != BLANK }) {
+			folded = gridCell{OVERFLOW, overflow_lane}
+		}
+		grid[y] = append(row[:start], folded)
+	}
+}
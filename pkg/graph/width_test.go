@@ -0,0 +1,94 @@
+package graph
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	color "git-graph/pkg/color"
+)
+
+// MaxX is the last lane a commit, dummy commits included, is drawn in
+func TestLayoutMaxX(t *testing.T) {
+	eachLayout(t, func(name string, layout Layout) {
+		if max_x := maxLane(layout.Commits); layout.MaxX != max_x {
+			t.Errorf("%s: MaxX is %d, the last lane used is %d", name, layout.MaxX, max_x)
+		}
+	})
+}
+
+// A branch drawn two columns from its parent moves into the free one, unless
+// another branch is drawn there on its rows.
+func TestCompactLanes(t *testing.T) {
+	history := func() CommitsMap {
+		return CommitsMap{
+			"m0000000": {Hash: "m0000000", Parents: []string{"m1111111"}, X_pos: 0, Y_pos: 0},
+			"m1111111": {Hash: "m1111111", Parents: []string{"m2222222"}, X_pos: 0, Y_pos: 1},
+			"f1111111": {Hash: "f1111111", Parents: []string{"f2222222"}, X_pos: 2, Y_pos: 2},
+			"m2222222": {Hash: "m2222222", Parents: []string{"m3333333"}, X_pos: 0, Y_pos: 3},
+			"f2222222": {Hash: "f2222222", Parents: []string{"m3333333"}, X_pos: 2, Y_pos: 4},
+			"m3333333": {Hash: "m3333333", X_pos: 0, Y_pos: 5},
+		}
+	}
+	commits_map := history()
+	if max_x := CompactLanes(commits_map); max_x != 1 {
+		t.Errorf("expected the branch moved to lane 1, got MaxX %d", max_x)
+	}
+	if commits_map["f1111111"].X_pos != 1 || commits_map["f2222222"].X_pos != 1 {
+		t.Errorf("expected the branch in lane 1, got %d and %d", commits_map["f1111111"].X_pos, commits_map["f2222222"].X_pos)
+	}
+	if crossings := CountCrossings(commits_map); crossings != 0 {
+		t.Errorf("expected no crossing, got %d", crossings)
+	}
+
+	commits_map = history()
+	commits_map["m0000000"].Parents = []string{"m1111111", "b1111111"}
+	commits_map["b1111111"] = &Commit{Hash: "b1111111", Parents: []string{"m2222222"}, X_pos: 1, Y_pos: 1}
+	commits_map["m1111111"].Y_pos = 2
+	commits_map["f1111111"].Y_pos = 3
+	commits_map["m2222222"].Y_pos = 4
+	commits_map["f2222222"].Y_pos = 5
+	commits_map["m3333333"].Y_pos = 6
+	if max_x := CompactLanes(commits_map); max_x != 2 {
+		t.Errorf("expected the branch kept in lane 2, got MaxX %d", max_x)
+	}
+}
+
+// The least used lanes are folded, wherever they are: lanes 4 and 5 of
+// many-merges-readable cover fewer rows than lane 6, which is kept.
+func TestFoldLanes(t *testing.T) {
+	cases := []struct {
+		fixture   string
+		max_lanes int
+		folded    []int
+	}{
+		{"canonical-octopus", 3, []int{2, 3, 4, 5}},
+		{"many-merges-readable", 6, []int{4, 5}},
+	}
+	for _, c := range cases {
+		commits := loadFixture(t, c.fixture)
+		options := DefaultRenderOptions()
+		options.Color = color.NoColor
+		options.Glyphs = ASCII_GLYPHS
+		options.MaxLanes = c.max_lanes
+		layout := ComputeLayout(&commits)
+		lines := DrawGraphLines(layout.Commits, layout.MaxX, layout.MaxY, options)
+
+		overflow := (c.max_lanes - 1) * X_SPACING
+		for _, line := range lines {
+			if len(strings.TrimRight(line.Graph, " ")) > overflow+1 {
+				t.Errorf("%s: expected at most %d lanes, got %q", c.fixture, c.max_lanes, line.Graph)
+			}
+			if line.Commit == nil {
+				continue
+			}
+			is_folded := slices.Contains(c.folded, line.Commit.X_pos)
+			if drawn := strings.IndexAny(line.Graph, "*o"); (drawn == overflow) != is_folded {
+				t.Errorf("%s: expected %s of lane %d drawn in the overflow lane %t, got %q", c.fixture, line.Hash[:8], line.Commit.X_pos, is_folded, line.Graph)
+			}
+		}
+		if text := linesText(lines); !strings.Contains(text, ":") {
+			t.Errorf("%s: expected overflow markers:\n%s", c.fixture, text)
+		}
+	}
+}
@@ -36,13 +36,28 @@ func GetDefaultLogger() *Logger {
 	return &Logger{}
 }
 
+var log_level = os.Getenv("GRAPH_LOG_LEVEL")
+var log_dir = ""
+
+// Configure overrides the level and the directory read from the environment.
+// An empty dir keeps the default $HOME/.git-graph/log.
+func Configure(level string, dir string) {
+	log_level = level
+	log_dir = dir
+}
+
 func IsDebug() bool {
-	return os.Getenv("GRAPH_LOG_LEVEL") == "debug"
+	return log_level == "debug"
 }
 
 func getLogLevel() slog.Level {
-	if IsDebug() {
+	switch log_level {
+	case "debug":
 		return slog.LevelDebug
+	case "info":
+		return slog.LevelInfo
+	case "error":
+		return slog.LevelError
 	}
 	return slog.LevelWarn
 }
@@ -50,9 +65,12 @@ func getLogLevel() slog.Level {
 func CreateDefaultLogger() *Logger {
 	logLevel := getLogLevel()
 
-	logDir := fmt.Sprintf("%s/.git-graph/log", os.Getenv("HOME"))
+	logDir := log_dir
+	if logDir == "" {
+		logDir = fmt.Sprintf("%s/.git-graph/log", os.Getenv("HOME"))
+	}
 	if _, err := os.Stat(logDir); os.IsNotExist(err) {
-		os.Mkdir(logDir, 0755)
+		os.MkdirAll(logDir, 0755)
 	}
 
 	filename := fmt.Sprintf("%s/%s.log", logDir, time.Now().Format("2006-01-02-15-04-05"))
@@ -0,0 +1,153 @@
+package repo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Signature struct {
+	Name   string
+	Email  string
+	When   int64
+	Offset string
+}
+
+type CommitObject struct {
+	Hash      string
+	Tree      string
+	Parents   []string
+	Author    Signature
+	Committer Signature
+	Message   string
+}
+
+type TagObject struct {
+	Object string
+	Type   string
+	Name   string
+}
+
+// Subject returns the first paragraph of the message joined into one line,
+// which is what git prints for %s.
+func (c *CommitObject) Subject() string {
+	paragraph, _, _ := strings.Cut(strings.TrimLeft(c.Message, "\n"), "\n\n")
+	lines := strings.Split(strings.TrimRight(paragraph, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.Join(lines, " ")
+}
+
+// Body returns the message after the subject paragraph, like %b without the
+// trailing newline.
+func (c *CommitObject) Body() string {
+	_, body, _ := strings.Cut(strings.TrimLeft(c.Message, "\n"), "\n\n")
+	return strings.TrimRight(strings.TrimLeft(body, "\n"), "\n")
+}
+
+func (r *Repository) ReadCommit(hash string) (*CommitObject, error) {
+	obj_type, data, err := r.ReadObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	if obj_type != ObjectCommit {
+		return nil, fmt.Errorf("object %s is a %s, not a commit", hash, obj_type)
+	}
+	commit, err := ParseCommit(data)
+	if err != nil {
+		return nil, fmt.Errorf("commit %s: %w", hash, err)
+	}
+	commit.Hash = hash
+	if r.IsShallow(hash) {
+		commit.Parents = []string{}
+	}
+	return commit, nil
+}
+
+// IsShallow reports whether the commit is a boundary of a shallow clone, in
+// which case its parents are not available.
+func (r *Repository) IsShallow(hash string) bool {
+	return r.shallow[hash]
+}
+
+func (r *Repository) commitParents(hash string) ([]string, error) {
+	commit, err := r.ReadCommit(hash)
+	if err != nil {
+		return nil, err
+	}
+	return commit.Parents, nil
+}
+
+func ParseCommit(data []byte) (*CommitObject, error) {
+	commit := &CommitObject{Parents: []string{}}
+	header, message, _ := bytes.Cut(data, []byte("\n\n"))
+	commit.Message = string(message)
+
+	for _, line := range strings.Split(string(header), "\n") {
+		// Continuation lines belong to multi-line headers such as gpgsig
+		if strings.HasPrefix(line, " ") {
+			continue
+		}
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "tree":
+			commit.Tree = value
+		case "parent":
+			commit.Parents = append(commit.Parents, value)
+		case "author":
+			commit.Author = parseSignature(value)
+		case "committer":
+			commit.Committer = parseSignature(value)
+		}
+	}
+	if commit.Tree == "" {
+		return nil, errors.New("missing tree header")
+	}
+	return commit, nil
+}
+
+func ParseTag(data []byte) (*TagObject, error) {
+	tag := &TagObject{}
+	header, _, _ := bytes.Cut(data, []byte("\n\n"))
+	for _, line := range strings.Split(string(header), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "object":
+			tag.Object = value
+		case "type":
+			tag.Type = value
+		case "tag":
+			tag.Name = value
+		}
+	}
+	if tag.Object == "" {
+		return nil, errors.New("missing object header")
+	}
+	return tag, nil
+}
+
+// parseSignature reads "Name <email> 1700000000 +0100". Names may contain
+// anything except angle brackets, so the email markers are searched from the right.
+func parseSignature(value string) Signature {
+	signature := Signature{}
+	email_end := strings.LastIndex(value, ">")
+	email_start := strings.LastIndex(value[:max(email_end, 0)], "<")
+	if email_start < 0 || email_end < 0 {
+		signature.Name = strings.TrimSpace(value)
+		return signature
+	}
+	signature.Name = strings.TrimSpace(value[:email_start])
+	signature.Email = value[email_start+1 : email_end]
+
+	fields := strings.Fields(value[email_end+1:])
+	if len(fields) > 0 {
+		signature.When, _ = strconv.ParseInt(fields[0], 10, 64)
+	}
+	if len(fields) > 1 {
+		signature.Offset = fields[1]
+	}
+	return signature
+}
@@ -0,0 +1,66 @@
+package repo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSignature(t *testing.T) {
+	for value, expected := range map[string]Signature{
+		"A U Thor <author@example.com> 1700000000 +0100":     {"A U Thor", "author@example.com", 1700000000, "+0100"},
+		"A U Thor <a u@example.com> 1700000000 -0230":        {"A U Thor", "a u@example.com", 1700000000, "-0230"},
+		"  Spaced  Out  <spaced@example.com>  1  -0000":      {"Spaced  Out", "spaced@example.com", 1, "-0000"},
+		"Thor (from <work>) <author@example.com> 5 +0000":    {"Thor (from <work>)", "author@example.com", 5, "+0000"},
+		"A U Thor <> 1700000000 +0100":                       {"A U Thor", "", 1700000000, "+0100"},
+		"A U Thor <author@example.com>":                      {"A U Thor", "author@example.com", 0, ""},
+		"A U Thor":                                           {"A U Thor", "", 0, ""},
+		"Before Epoch <author@example.com> -86400 -1200":     {"Before Epoch", "author@example.com", -86400, "-1200"},
+		"Bad Date <author@example.com> yesterday +0100":      {"Bad Date", "author@example.com", 0, "+0100"},
+		"Unicode Ñame <ñ@example.com> 1700000000 +0545":      {"Unicode Ñame", "ñ@example.com", 1700000000, "+0545"},
+		"No Space<author@example.com>1700000000 +0100 extra": {"No Space", "author@example.com", 1700000000, "+0100"},
+	} {
+		if signature := parseSignature(value); signature != expected {
+			t.Errorf("%q: expected %+v, got %+v", value, expected, signature)
+		}
+	}
+}
+
+func TestParseCommit(t *testing.T) {
+	commit, err := ParseCommit([]byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"parent 1111111111111111111111111111111111111111\n" +
+		"parent 2222222222222222222222222222222222222222\n" +
+		"author A U Thor <author@example.com> 1700000000 -0230\n" +
+		"committer C O Mitter <committer@example.com> 1700000060 +0100\n" +
+		"gpgsig -----BEGIN PGP SIGNATURE-----\n" +
+		" committer Not Me <fake@example.com> 1 +0000\n" +
+		" -----END PGP SIGNATURE-----\n" +
+		"\n" +
+		"Subject\n\nBody\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &CommitObject{
+		Tree:      "4b825dc642cb6eb9a060e54bf8d69288fbee4904",
+		Parents:   []string{"1111111111111111111111111111111111111111", "2222222222222222222222222222222222222222"},
+		Author:    Signature{"A U Thor", "author@example.com", 1700000000, "-0230"},
+		Committer: Signature{"C O Mitter", "committer@example.com", 1700000060, "+0100"},
+		Message:   "Subject\n\nBody\n",
+	}
+	if !reflect.DeepEqual(commit, expected) {
+		t.Errorf("expected %+v, got %+v", expected, commit)
+	}
+
+	// git accepts commits without a committer, e.g. very old imports
+	commit, err = ParseCommit([]byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"author A U Thor <author@example.com> 1700000000 -0230\n\nno committer\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit.Committer != (Signature{}) || commit.Author.Name != "A U Thor" || len(commit.Parents) != 0 {
+		t.Errorf("unexpected commit without committer %+v", commit)
+	}
+
+	if _, err := ParseCommit([]byte("author A U Thor <author@example.com> 1700000000 +0000\n\nno tree\n")); err == nil {
+		t.Error("expected an error without a tree")
+	}
+}
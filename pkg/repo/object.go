@@ -0,0 +1,130 @@
+package repo
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+type ObjectType int
+
+const (
+	ObjectCommit   ObjectType = 1
+	ObjectTree     ObjectType = 2
+	ObjectBlob     ObjectType = 3
+	ObjectTag      ObjectType = 4
+	objectOfsDelta ObjectType = 6
+	objectRefDelta ObjectType = 7
+)
+
+var ErrObjectNotFound = errors.New("object not found")
+
+func (t ObjectType) String() string {
+	switch t {
+	case ObjectCommit:
+		return "commit"
+	case ObjectTree:
+		return "tree"
+	case ObjectBlob:
+		return "blob"
+	case ObjectTag:
+		return "tag"
+	}
+	return "unknown"
+}
+
+func parseObjectType(name string) (ObjectType, error) {
+	switch name {
+	case "commit":
+		return ObjectCommit, nil
+	case "tree":
+		return ObjectTree, nil
+	case "blob":
+		return ObjectBlob, nil
+	case "tag":
+		return ObjectTag, nil
+	}
+	return 0, fmt.Errorf("unknown object type %q", name)
+}
+
+func (r *Repository) ReadObject(hash string) (ObjectType, []byte, error) {
+	if len(hash) != 40 {
+		return 0, nil, fmt.Errorf("invalid object name %q", hash)
+	}
+	for _, dir := range r.object_dirs {
+		obj_type, data, err := readLooseObject(filepath.Join(dir, hash[:2], hash[2:]))
+		if err == nil {
+			return obj_type, data, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return 0, nil, fmt.Errorf("loose object %s: %w", hash, err)
+		}
+	}
+
+	raw_hash, err := hex.DecodeString(hash)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid object name %q", hash)
+	}
+	if err := r.loadPacks(); err != nil {
+		return 0, nil, err
+	}
+	for _, pack := range r.packs {
+		if offset, found := pack.find(raw_hash); found {
+			return pack.readObject(r, offset)
+		}
+	}
+	return 0, nil, fmt.Errorf("%w: %s", ErrObjectNotFound, hash)
+}
+
+func (r *Repository) HasObject(hash string) bool {
+	_, _, err := r.ReadObject(hash)
+	return err == nil
+}
+
+func readLooseObject(path string) (ObjectType, []byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.Close()
+
+	reader, err := zlib.NewReader(file)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	header_end := bytes.IndexByte(content, 0)
+	if header_end < 0 {
+		return 0, nil, errors.New("malformed object header")
+	}
+	type_name, size_str, found := bytes.Cut(content[:header_end], []byte(" "))
+	if !found {
+		return 0, nil, errors.New("malformed object header")
+	}
+	obj_type, err := parseObjectType(string(type_name))
+	if err != nil {
+		return 0, nil, err
+	}
+	size, err := strconv.Atoi(string(size_str))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	data := content[header_end+1:]
+	if len(data) != size {
+		return 0, nil, fmt.Errorf("object size mismatch: expected %d, got %d", size, len(data))
+	}
+	return obj_type, data, nil
+}
@@ -0,0 +1,317 @@
+package repo
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const max_cached_pack_objects = 1024
+
+type cachedObject struct {
+	obj_type ObjectType
+	data     []byte
+}
+
+type packFile struct {
+	path    string
+	file    *os.File
+	names   []byte
+	offsets []int64
+	cache   map[int64]cachedObject
+}
+
+var idx_v2_magic = []byte{0xff, 't', 'O', 'c'}
+
+func (r *Repository) loadPacks() error {
+	if r.packs_ready {
+		return nil
+	}
+	for _, dir := range r.object_dirs {
+		idx_files, err := filepath.Glob(filepath.Join(dir, "pack", "*.idx"))
+		if err != nil {
+			return err
+		}
+		sort.Strings(idx_files)
+		for _, idx_file := range idx_files {
+			pack, err := openPack(idx_file)
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				}
+				return fmt.Errorf("pack %s: %w", idx_file, err)
+			}
+			r.packs = append(r.packs, pack)
+		}
+	}
+	r.packs_ready = true
+	return nil
+}
+
+func openPack(idx_path string) (*packFile, error) {
+	idx, err := os.ReadFile(idx_path)
+	if err != nil {
+		return nil, err
+	}
+	pack_path := strings.TrimSuffix(idx_path, ".idx") + ".pack"
+	file, err := os.Open(pack_path)
+	if err != nil {
+		return nil, err
+	}
+
+	pack := &packFile{path: pack_path, file: file, cache: make(map[int64]cachedObject)}
+	if bytes.HasPrefix(idx, idx_v2_magic) {
+		err = pack.parseIndexV2(idx)
+	} else {
+		err = pack.parseIndexV1(idx)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return pack, nil
+}
+
+func (p *packFile) parseIndexV1(idx []byte) error {
+	if len(idx) < 256*4 {
+		return errors.New("truncated index")
+	}
+	count := int(binary.BigEndian.Uint32(idx[255*4:]))
+	entries := idx[256*4:]
+	if len(entries) < count*24 {
+		return errors.New("truncated index")
+	}
+	p.names = make([]byte, count*20)
+	p.offsets = make([]int64, count)
+	for i := range count {
+		entry := entries[i*24:]
+		p.offsets[i] = int64(binary.BigEndian.Uint32(entry))
+		copy(p.names[i*20:], entry[4:24])
+	}
+	return nil
+}
+
+func (p *packFile) parseIndexV2(idx []byte) error {
+	if len(idx) < 8+256*4 || binary.BigEndian.Uint32(idx[4:]) != 2 {
+		return errors.New("unsupported index version")
+	}
+	fanout := idx[8:]
+	count := int(binary.BigEndian.Uint32(fanout[255*4:]))
+
+	names_start := 8 + 256*4
+	crc_start := names_start + count*20
+	offsets_start := crc_start + count*4
+	large_start := offsets_start + count*4
+	if len(idx) < large_start {
+		return errors.New("truncated index")
+	}
+
+	p.names = idx[names_start:crc_start]
+	p.offsets = make([]int64, count)
+	for i := range count {
+		offset := binary.BigEndian.Uint32(idx[offsets_start+i*4:])
+		if offset&0x80000000 == 0 {
+			p.offsets[i] = int64(offset)
+			continue
+		}
+		large_pos := large_start + int(offset&0x7fffffff)*8
+		if len(idx) < large_pos+8 {
+			return errors.New("truncated index")
+		}
+		p.offsets[i] = int64(binary.BigEndian.Uint64(idx[large_pos:]))
+	}
+	return nil
+}
+
+func (p *packFile) find(raw_hash []byte) (int64, bool) {
+	count := len(p.offsets)
+	i := sort.Search(count, func(i int) bool {
+		return bytes.Compare(p.names[i*20:i*20+20], raw_hash) >= 0
+	})
+	if i < count && bytes.Equal(p.names[i*20:i*20+20], raw_hash) {
+		return p.offsets[i], true
+	}
+	return 0, false
+}
+
+func (p *packFile) close() {
+	p.file.Close()
+}
+
+func (p *packFile) readObject(r *Repository, offset int64) (ObjectType, []byte, error) {
+	if cached, exists := p.cache[offset]; exists {
+		return cached.obj_type, cached.data, nil
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(p.file, offset, 1<<62))
+	header, err := reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	obj_type := ObjectType((header >> 4) & 7)
+	size := int64(header & 0x0f)
+	shift := 4
+	for header&0x80 != 0 {
+		if header, err = reader.ReadByte(); err != nil {
+			return 0, nil, err
+		}
+		size |= int64(header&0x7f) << shift
+		shift += 7
+	}
+
+	var base_type ObjectType
+	var base []byte
+	switch obj_type {
+	case objectOfsDelta:
+		distance, err := readOffsetDistance(reader)
+		if err != nil {
+			return 0, nil, err
+		}
+		base_type, base, err = p.readObject(r, offset-distance)
+		if err != nil {
+			return 0, nil, err
+		}
+	case objectRefDelta:
+		raw_base := make([]byte, 20)
+		if _, err := io.ReadFull(reader, raw_base); err != nil {
+			return 0, nil, err
+		}
+		base_type, base, err = r.ReadObject(hex.EncodeToString(raw_base))
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	data, err := inflate(reader, size)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%s at %d: %w", p.path, offset, err)
+	}
+	if base != nil {
+		obj_type = base_type
+		if data, err = applyDelta(base, data); err != nil {
+			return 0, nil, fmt.Errorf("%s at %d: %w", p.path, offset, err)
+		}
+	}
+
+	if len(p.cache) >= max_cached_pack_objects {
+		clear(p.cache)
+	}
+	p.cache[offset] = cachedObject{obj_type, data}
+	return obj_type, data, nil
+}
+
+func readOffsetDistance(reader io.ByteReader) (int64, error) {
+	c, err := reader.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	distance := int64(c & 0x7f)
+	for c&0x80 != 0 {
+		if c, err = reader.ReadByte(); err != nil {
+			return 0, err
+		}
+		distance = ((distance + 1) << 7) | int64(c&0x7f)
+	}
+	return distance, nil
+}
+
+func inflate(reader io.Reader, size int64) ([]byte, error) {
+	zreader, err := zlib.NewReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	defer zreader.Close()
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(zreader, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func readDeltaSize(delta []byte, pos *int) (int, error) {
+	size := 0
+	shift := 0
+	for {
+		if *pos >= len(delta) {
+			return 0, errors.New("truncated delta header")
+		}
+		c := delta[*pos]
+		*pos++
+		size |= int(c&0x7f) << shift
+		shift += 7
+		if c&0x80 == 0 {
+			return size, nil
+		}
+	}
+}
+
+func applyDelta(base, delta []byte) ([]byte, error) {
+	pos := 0
+	base_size, err := readDeltaSize(delta, &pos)
+	if err != nil {
+		return nil, err
+	}
+	if base_size != len(base) {
+		return nil, errors.New("delta base size mismatch")
+	}
+	result_size, err := readDeltaSize(delta, &pos)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, 0, result_size)
+	for pos < len(delta) {
+		op := delta[pos]
+		pos++
+		if op&0x80 == 0 {
+			if op == 0 || pos+int(op) > len(delta) {
+				return nil, errors.New("invalid delta insert")
+			}
+			result = append(result, delta[pos:pos+int(op)]...)
+			pos += int(op)
+			continue
+		}
+
+		copy_offset, copy_size := 0, 0
+		for i := range 4 {
+			if op&(1<<i) != 0 {
+				if pos >= len(delta) {
+					return nil, errors.New("truncated delta copy")
+				}
+				copy_offset |= int(delta[pos]) << (8 * i)
+				pos++
+			}
+		}
+		for i := range 3 {
+			if op&(0x10<<i) != 0 {
+				if pos >= len(delta) {
+					return nil, errors.New("truncated delta copy")
+				}
+				copy_size |= int(delta[pos]) << (8 * i)
+				pos++
+			}
+		}
+		if copy_size == 0 {
+			copy_size = 0x10000
+		}
+		if copy_offset+copy_size > len(base) {
+			return nil, errors.New("delta copy out of range")
+		}
+		result = append(result, base[copy_offset:copy_offset+copy_size]...)
+	}
+
+	if len(result) != result_size {
+		return nil, errors.New("delta result size mismatch")
+	}
+	return result, nil
+}
@@ -0,0 +1,399 @@
+package repo
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrBadRevision = errors.New("bad revision")
+
+// ErrRevisionSyntax is returned for revisions written with gitrevisions(7)
+// syntax that ResolveRevision does not parse, such as rev^{commit} or @{u}
+var ErrRevisionSyntax = errors.New("unsupported revision syntax")
+
+const max_symref_depth = 5
+
+type Reference struct {
+	Name   string
+	Hash   string
+	Peeled string
+}
+
+// Commit returns the hash of the commit the reference ends up at, following
+// annotated tags.
+func (ref Reference) Commit() string {
+	if ref.Peeled != "" {
+		return ref.Peeled
+	}
+	return ref.Hash
+}
+
+// Head returns the branch HEAD points at (empty when detached) and the commit
+// it resolves to (empty on an unborn branch).
+func (r *Repository) Head() (string, string, error) {
+	return r.readHead(r.GitDir)
+}
+
+func (r *Repository) readHead(git_dir string) (string, string, error) {
+	content, err := os.ReadFile(filepath.Join(git_dir, "HEAD"))
+	if err != nil {
+		return "", "", err
+	}
+	line := strings.TrimSpace(string(content))
+	if !strings.HasPrefix(line, "ref:") {
+		return "", line, nil
+	}
+	target := strings.TrimSpace(strings.TrimPrefix(line, "ref:"))
+	hash, err := r.resolveRefName(target, 0)
+	if err != nil {
+		return target, "", nil
+	}
+	return target, hash, nil
+}
+
+// References lists every ref under refs/, with loose refs taking precedence
+// over packed ones. The result is sorted by name.
+func (r *Repository) References() ([]Reference, error) {
+	refs := make(map[string]Reference)
+	if err := r.readPackedRefs(refs); err != nil {
+		return nil, err
+	}
+
+	refs_dir := filepath.Join(r.CommonDir, "refs")
+	symbolic := make(map[string]string)
+	err := filepath.WalkDir(refs_dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(r.CommonDir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		line := strings.TrimSpace(string(content))
+		if strings.HasPrefix(line, "ref:") {
+			symbolic[name] = strings.TrimSpace(strings.TrimPrefix(line, "ref:"))
+			return nil
+		}
+		if !isFullHash(line) {
+			return nil
+		}
+		refs[name] = Reference{Name: name, Hash: line}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for name, target := range symbolic {
+		if hash, err := r.resolveRefName(target, 1); err == nil {
+			refs[name] = Reference{Name: name, Hash: hash}
+		}
+	}
+
+	result := make([]Reference, 0, len(refs))
+	for _, ref := range refs {
+		if ref.Peeled == "" {
+			peeled, err := r.peel(ref.Hash)
+			if err != nil {
+				// Dangling refs are ignored just like git does
+				continue
+			}
+			if peeled != ref.Hash {
+				ref.Peeled = peeled
+			}
+		}
+		result = append(result, ref)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+func (r *Repository) readPackedRefs(refs map[string]Reference) error {
+	file, err := os.Open(filepath.Join(r.CommonDir, "packed-refs"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	last := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") || line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "^") {
+			if ref, exists := refs[last]; exists {
+				ref.Peeled = strings.TrimSpace(line[1:])
+				refs[last] = ref
+			}
+			continue
+		}
+		hash, name, found := strings.Cut(line, " ")
+		if !found || !isFullHash(hash) {
+			continue
+		}
+		refs[name] = Reference{Name: name, Hash: hash}
+		last = name
+	}
+	return scanner.Err()
+}
+
+func (r *Repository) resolveRefName(name string, depth int) (string, error) {
+	if depth > max_symref_depth {
+		return "", fmt.Errorf("%w: symbolic ref loop at %s", ErrBadRevision, name)
+	}
+
+	dirs := []string{r.CommonDir}
+	if !strings.HasPrefix(name, "refs/") || strings.HasPrefix(name, "refs/worktree/") || strings.HasPrefix(name, "refs/bisect/") {
+		dirs = []string{r.GitDir, r.CommonDir}
+	}
+	for _, dir := range dirs {
+		content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			continue
+		}
+		line := strings.TrimSpace(string(content))
+		if strings.HasPrefix(line, "ref:") {
+			return r.resolveRefName(strings.TrimSpace(strings.TrimPrefix(line, "ref:")), depth+1)
+		}
+		// FETCH_HEAD may contain several lines, the first one wins
+		if len(line) >= 40 && isFullHash(line[:40]) {
+			return line[:40], nil
+		}
+	}
+
+	packed := make(map[string]Reference)
+	if err := r.readPackedRefs(packed); err != nil {
+		return "", err
+	}
+	if ref, exists := packed[name]; exists {
+		return ref.Hash, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrBadRevision, name)
+}
+
+// peel follows annotated tags until it reaches a non-tag object.
+func (r *Repository) peel(hash string) (string, error) {
+	for range max_symref_depth * 10 {
+		obj_type, data, err := r.ReadObject(hash)
+		if err != nil {
+			return "", err
+		}
+		if obj_type != ObjectTag {
+			return hash, nil
+		}
+		tag, err := ParseTag(data)
+		if err != nil {
+			return "", err
+		}
+		hash = tag.Object
+	}
+	return "", fmt.Errorf("tag chain too long at %s", hash)
+}
+
+// ResolveRevision understands the subset of gitrevisions(7) needed to pick
+// commits: full and abbreviated hashes, ref names and the ~N, ^ and ^N suffixes.
+func (r *Repository) ResolveRevision(rev string) (string, error) {
+	base, suffix := splitRevisionSuffix(rev)
+	if base == "@" || strings.ContainsAny(rev, "{}") || strings.Trim(suffix, "~^0123456789") != "" {
+		return "", fmt.Errorf("%w: %s", ErrRevisionSyntax, rev)
+	}
+	if base == "" {
+		base = "HEAD"
+	}
+
+	hash, err := r.resolveBase(base)
+	if err != nil {
+		return "", err
+	}
+	if hash, err = r.peelToCommit(hash, rev); err != nil {
+		return "", err
+	}
+
+	for suffix != "" {
+		op := suffix[0]
+		suffix = suffix[1:]
+		digits := 0
+		for digits < len(suffix) && suffix[digits] >= '0' && suffix[digits] <= '9' {
+			digits++
+		}
+		n := 1
+		if digits > 0 {
+			n, _ = strconv.Atoi(suffix[:digits])
+			suffix = suffix[digits:]
+		}
+
+		if op == '^' {
+			if n == 0 {
+				continue
+			}
+			parents, err := r.commitParents(hash)
+			if err != nil {
+				return "", err
+			}
+			if n > len(parents) {
+				return "", fmt.Errorf("%w: %s", ErrBadRevision, rev)
+			}
+			hash = parents[n-1]
+			continue
+		}
+		for range n {
+			parents, err := r.commitParents(hash)
+			if err != nil {
+				return "", err
+			}
+			if len(parents) == 0 {
+				return "", fmt.Errorf("%w: %s", ErrBadRevision, rev)
+			}
+			hash = parents[0]
+		}
+	}
+	return hash, nil
+}
+
+func splitRevisionSuffix(rev string) (string, string) {
+	index := strings.IndexAny(rev, "~^")
+	if index < 0 {
+		return rev, ""
+	}
+	return rev[:index], rev[index:]
+}
+
+func (r *Repository) resolveBase(base string) (string, error) {
+	if isFullHash(base) {
+		return base, nil
+	}
+
+	candidates := []string{base}
+	if !strings.HasPrefix(base, "refs/") && strings.ToUpper(base) != base {
+		candidates = nil
+	}
+	candidates = append(candidates,
+		"refs/"+base,
+		"refs/tags/"+base,
+		"refs/heads/"+base,
+		"refs/remotes/"+base,
+		"refs/remotes/"+base+"/HEAD",
+	)
+	for _, name := range candidates {
+		if hash, err := r.resolveRefName(name, 0); err == nil {
+			return hash, nil
+		}
+	}
+
+	if len(base) >= 4 && isHex(base) {
+		return r.resolvePrefix(strings.ToLower(base))
+	}
+	return "", fmt.Errorf("%w: %s", ErrBadRevision, base)
+}
+
+func (r *Repository) resolvePrefix(prefix string) (string, error) {
+	matches := make(map[string]bool)
+	for _, dir := range r.object_dirs {
+		entries, err := os.ReadDir(filepath.Join(dir, prefix[:2]))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			hash := prefix[:2] + entry.Name()
+			if strings.HasPrefix(hash, prefix) && isFullHash(hash) {
+				matches[hash] = true
+			}
+		}
+	}
+
+	if err := r.loadPacks(); err != nil {
+		return "", err
+	}
+	for _, pack := range r.packs {
+		for _, hash := range pack.findPrefix(prefix) {
+			matches[hash] = true
+		}
+	}
+
+	if len(matches) == 1 {
+		for hash := range matches {
+			return hash, nil
+		}
+	}
+	if len(matches) > 1 {
+		return "", fmt.Errorf("%w: short object ID %s is ambiguous", ErrBadRevision, prefix)
+	}
+	return "", fmt.Errorf("%w: %s", ErrBadRevision, prefix)
+}
+
+func (p *packFile) findPrefix(prefix string) []string {
+	// Pad the prefix so it sorts before every name it prefixes
+	padded := prefix + strings.Repeat("0", 40-len(prefix))
+	raw, err := hex.DecodeString(padded)
+	if err != nil {
+		return nil
+	}
+	count := len(p.offsets)
+	i := sort.Search(count, func(i int) bool {
+		return string(p.names[i*20:i*20+20]) >= string(raw)
+	})
+
+	matches := make([]string, 0)
+	for ; i < count; i++ {
+		hash := hex.EncodeToString(p.names[i*20 : i*20+20])
+		if !strings.HasPrefix(hash, prefix) {
+			break
+		}
+		matches = append(matches, hash)
+	}
+	return matches
+}
+
+func (r *Repository) peelToCommit(hash, rev string) (string, error) {
+	peeled, err := r.peel(hash)
+	if err != nil {
+		return "", err
+	}
+	obj_type, _, err := r.ReadObject(peeled)
+	if err != nil {
+		return "", err
+	}
+	if obj_type != ObjectCommit {
+		return "", fmt.Errorf("%w: %s is a %s, not a commit", ErrBadRevision, rev, obj_type)
+	}
+	return peeled, nil
+}
+
+func isFullHash(s string) bool {
+	return len(s) == 40 && isHex(s)
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,204 @@
+package repo
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrNotRepository = errors.New("not a git repository")
+var ErrUnsupported = errors.New("unsupported repository format")
+
+type Repository struct {
+	GitDir    string
+	CommonDir string
+
+	object_dirs []string
+	packs       []*packFile
+	packs_ready bool
+	shallow     map[string]bool
+	config      map[string]string
+}
+
+// Discover looks for a git directory starting at path and walking up to the
+// filesystem root, the same way git does when no GIT_DIR is set.
+func Discover(path string) (*Repository, error) {
+	if git_dir := os.Getenv("GIT_DIR"); git_dir != "" {
+		return Open(git_dir)
+	}
+
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		dot_git := filepath.Join(dir, ".git")
+		if info, err := os.Stat(dot_git); err == nil {
+			if info.IsDir() {
+				return Open(dot_git)
+			}
+			git_dir, err := readGitFile(dot_git)
+			if err != nil {
+				return nil, err
+			}
+			return Open(git_dir)
+		}
+		if isGitDir(dir) {
+			return Open(dir)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, ErrNotRepository
+		}
+		dir = parent
+	}
+}
+
+func Open(git_dir string) (*Repository, error) {
+	git_dir, err := filepath.Abs(git_dir)
+	if err != nil {
+		return nil, err
+	}
+	if !isGitDir(git_dir) {
+		return nil, fmt.Errorf("%w: %s", ErrNotRepository, git_dir)
+	}
+
+	common_dir := git_dir
+	if content, err := os.ReadFile(filepath.Join(git_dir, "commondir")); err == nil {
+		common_dir = strings.TrimSpace(string(content))
+		if !filepath.IsAbs(common_dir) {
+			common_dir = filepath.Join(git_dir, common_dir)
+		}
+		common_dir = filepath.Clean(common_dir)
+	}
+
+	r := &Repository{GitDir: git_dir, CommonDir: common_dir}
+	r.config = readConfig(filepath.Join(common_dir, "config"))
+	if err := r.checkFormat(); err != nil {
+		return nil, err
+	}
+	r.object_dirs = r.readObjectDirs()
+	r.shallow = r.readShallow()
+	return r, nil
+}
+
+func (r *Repository) Close() {
+	for _, pack := range r.packs {
+		pack.close()
+	}
+	r.packs = nil
+	r.packs_ready = false
+}
+
+func isGitDir(dir string) bool {
+	for _, name := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			// Linked worktrees keep objects and refs in the common dir
+			if name != "HEAD" {
+				if _, err := os.Stat(filepath.Join(dir, "commondir")); err == nil {
+					continue
+				}
+			}
+			return false
+		}
+	}
+	return true
+}
+
+func readGitFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	line := strings.TrimSpace(string(content))
+	if !strings.HasPrefix(line, "gitdir:") {
+		return "", fmt.Errorf("%w: invalid gitfile format %s", ErrNotRepository, path)
+	}
+	git_dir := strings.TrimSpace(strings.TrimPrefix(line, "gitdir:"))
+	if !filepath.IsAbs(git_dir) {
+		git_dir = filepath.Join(filepath.Dir(path), git_dir)
+	}
+	return git_dir, nil
+}
+
+// checkFormat rejects repositories this reader cannot handle, so callers can
+// fall back to the git binary.
+func (r *Repository) checkFormat() error {
+	if value := r.config["extensions.objectformat"]; value != "" && strings.ToLower(value) != "sha1" {
+		return fmt.Errorf("%w: object format %s", ErrUnsupported, strings.ToLower(value))
+	}
+	if value := r.config["extensions.refstorage"]; value != "" && strings.ToLower(value) != "files" {
+		return fmt.Errorf("%w: ref storage %s", ErrUnsupported, strings.ToLower(value))
+	}
+	// Missing objects of partial clones are fetched by git, not read here
+	if r.config["extensions.partialclone"] != "" {
+		return fmt.Errorf("%w: partial clone", ErrUnsupported)
+	}
+	return nil
+}
+
+// readConfig reads the values of the repository config file by lower case
+// "section.key", subsections are not told apart.
+func readConfig(path string) map[string]string {
+	config := make(map[string]string)
+	file, err := os.Open(path)
+	if err != nil {
+		return config
+	}
+	defer file.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			section, _, _ = strings.Cut(strings.ToLower(strings.Trim(line, "[] ")), " ")
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found || section == "" {
+			continue
+		}
+		config[section+"."+strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+	return config
+}
+
+func (r *Repository) readObjectDirs() []string {
+	objects_dir := filepath.Join(r.CommonDir, "objects")
+	dirs := []string{objects_dir}
+
+	content, err := os.ReadFile(filepath.Join(objects_dir, "info", "alternates"))
+	if err != nil {
+		return dirs
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(objects_dir, line)
+		}
+		dirs = append(dirs, filepath.Clean(line))
+	}
+	return dirs
+}
+
+func (r *Repository) readShallow() map[string]bool {
+	shallow := make(map[string]bool)
+	content, err := os.ReadFile(filepath.Join(r.CommonDir, "shallow"))
+	if err != nil {
+		return shallow
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			shallow[line] = true
+		}
+	}
+	return shallow
+}
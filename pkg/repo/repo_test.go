@@ -0,0 +1,273 @@
+package repo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func runGit(t *testing.T, dir string, stdin string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(cmd.Environ(),
+		"GIT_CONFIG_NOSYSTEM=1", "GIT_CONFIG_GLOBAL=/dev/null",
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, stderr.String())
+	}
+	return string(output)
+}
+
+// newTestRepo builds a history with a merge, an annotated and a lightweight
+// tag, and a file changed a little by every commit so packs get deltas.
+func newTestRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	runGit(t, dir, "", "init", "-q", "-b", "main")
+	lines := make([]string, 200)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d of a file long enough to be stored as a delta", i)
+	}
+	commit := func(i int, message string) {
+		lines[i*7%len(lines)] = fmt.Sprintf("changed by %s", message)
+		if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		runGit(t, dir, "", "add", "file.txt")
+		runGit(t, dir, "", "commit", "-q", "-m", message)
+	}
+	for i := range 4 {
+		commit(i, fmt.Sprintf("main %d", i))
+	}
+	runGit(t, dir, "", "tag", "-a", "-m", "release", "v1")
+	runGit(t, dir, "", "checkout", "-q", "-b", "topic", "HEAD~2")
+	for i := 4; i < 7; i++ {
+		commit(i, fmt.Sprintf("topic %d", i))
+	}
+	runGit(t, dir, "", "tag", "light")
+	runGit(t, dir, "", "checkout", "-q", "main")
+	runGit(t, dir, "", "merge", "-q", "--no-ff", "-m", "merge topic", "topic")
+	return dir
+}
+
+// checkObjects reads every object of the history of dir from git_dir and
+// compares it with git cat-file.
+func checkObjects(t *testing.T, dir string, git_dir string) {
+	t.Helper()
+	repo, err := Open(git_dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	hashes := strings.Fields(runGit(t, dir, "", "rev-list", "--objects", "--no-object-names", "--all"))
+	hashes = append(hashes, strings.TrimSpace(runGit(t, dir, "", "rev-parse", "v1")))
+	for _, hash := range hashes {
+		obj_type, data, err := repo.ReadObject(hash)
+		if err != nil {
+			t.Fatalf("%s: %v", hash, err)
+		}
+		expected_type := strings.TrimSpace(runGit(t, dir, "", "cat-file", "-t", hash))
+		if obj_type.String() != expected_type {
+			t.Errorf("%s: expected a %s, got a %s", hash, expected_type, obj_type)
+		}
+		if expected := runGit(t, dir, "", "cat-file", expected_type, hash); string(data) != expected {
+			t.Errorf("%s: content differs from git cat-file", hash)
+		}
+	}
+}
+
+func TestLooseObjects(t *testing.T) {
+	dir := newTestRepo(t)
+	checkObjects(t, dir, filepath.Join(dir, ".git"))
+
+	repo, err := Open(filepath.Join(dir, ".git"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	if _, _, err := repo.ReadObject(strings.Repeat("0", 40)); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("expected object not found, got %v", err)
+	}
+}
+
+func TestPackedObjects(t *testing.T) {
+	dir := newTestRepo(t)
+	objects := runGit(t, dir, "", "rev-list", "--objects", "--all")
+	for _, pack := range []struct {
+		name          string
+		args          []string
+		index_version int
+	}{
+		// Deltas name their base by hash unless --delta-base-offset is given
+		{"idx-v1-ref-delta", []string{"--index-version=1"}, 1},
+		{"idx-v2-ref-delta", []string{"--index-version=2"}, 2},
+		{"idx-v2-ofs-delta", []string{"--index-version=2", "--delta-base-offset"}, 2},
+	} {
+		t.Run(pack.name, func(t *testing.T) {
+			git_dir := t.TempDir()
+			runGit(t, git_dir, "", "init", "-q", "--bare")
+			prefix := filepath.Join(git_dir, "objects", "pack", "pack")
+			runGit(t, dir, objects, append([]string{"pack-objects", "-q", "--window=10", "--depth=10"}, append(pack.args, prefix)...)...)
+
+			idx_files, _ := filepath.Glob(prefix + "-*.idx")
+			if len(idx_files) != 1 {
+				t.Fatalf("expected one pack, got %v", idx_files)
+			}
+			idx, err := os.ReadFile(idx_files[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if is_v2 := bytes.HasPrefix(idx, idx_v2_magic); is_v2 != (pack.index_version == 2) {
+				t.Fatalf("expected an index version %d", pack.index_version)
+			}
+			// Deltas are listed with their depth and base
+			deltas := 0
+			for _, line := range strings.Split(runGit(t, dir, "", "verify-pack", "-v", idx_files[0]), "\n") {
+				if len(strings.Fields(line)) == 7 {
+					deltas++
+				}
+			}
+			if deltas == 0 {
+				t.Fatal("expected deltas in the pack")
+			}
+			checkObjects(t, dir, git_dir)
+		})
+	}
+}
+
+func TestPackedRefs(t *testing.T) {
+	dir := newTestRepo(t)
+	runGit(t, dir, "", "pack-refs", "--all")
+	// A loose ref wins over its packed value
+	runGit(t, dir, "", "update-ref", "refs/heads/topic", "topic~1")
+
+	repo, err := Open(filepath.Join(dir, ".git"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	refs, err := repo.References()
+	if err != nil {
+		t.Fatal(err)
+	}
+	by_name := make(map[string]Reference)
+	for _, ref := range refs {
+		by_name[ref.Name] = ref
+	}
+	rev_parse := func(rev string) string {
+		return strings.TrimSpace(runGit(t, dir, "", "rev-parse", rev))
+	}
+
+	if tag := by_name["refs/tags/v1"]; tag.Hash != rev_parse("v1") || tag.Peeled != rev_parse("v1^{commit}") || tag.Commit() != rev_parse("main^1") {
+		t.Errorf("unexpected annotated tag %+v", tag)
+	}
+	if tag := by_name["refs/tags/light"]; tag.Hash != rev_parse("light") || tag.Peeled != "" {
+		t.Errorf("unexpected lightweight tag %+v", tag)
+	}
+	if topic := by_name["refs/heads/topic"]; topic.Hash != rev_parse("topic") || topic.Hash != rev_parse("light~1") {
+		t.Errorf("expected the loose topic ref, got %+v", topic)
+	}
+	if main := by_name["refs/heads/main"]; main.Hash != rev_parse("main") {
+		t.Errorf("unexpected main %+v", main)
+	}
+	if hash, err := repo.ResolveRevision("v1"); err != nil || hash != rev_parse("v1^{commit}") {
+		t.Errorf("expected v1 resolved from packed-refs to its commit, got %s, %v", hash, err)
+	}
+}
+
+func TestResolveRevision(t *testing.T) {
+	dir := newTestRepo(t)
+	rev_parse := func(rev string) string {
+		return strings.TrimSpace(runGit(t, dir, "", "rev-parse", rev))
+	}
+	check := func(t *testing.T) {
+		repo, err := Open(filepath.Join(dir, ".git"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer repo.Close()
+		for _, rev := range []string{"HEAD", "main", "HEAD~1", "HEAD^2", "main^2~2", "HEAD^", "topic", "v1", "v1~1", "light^0", "refs/heads/topic", rev_parse("HEAD~3")[:4], rev_parse("topic")[:7]} {
+			hash, err := repo.ResolveRevision(rev)
+			if err != nil {
+				t.Errorf("%s: %v", rev, err)
+			} else if expected := rev_parse(rev + "^{commit}"); hash != expected {
+				t.Errorf("%s: expected %s, got %s", rev, expected, hash)
+			}
+		}
+		// git needs at least 4 characters before taking a name as a hash
+		for _, rev := range []string{rev_parse("HEAD")[:3], rev_parse("HEAD")[:1], "nope", "HEAD^3", "HEAD~20", rev_parse("HEAD^{tree}")} {
+			if hash, err := repo.ResolveRevision(rev); !errors.Is(err, ErrBadRevision) {
+				t.Errorf("%s: expected a bad revision, got %s, %v", rev, hash, err)
+			}
+		}
+		for _, rev := range []string{"HEAD^{commit}", "v1^{}", "main@{1}", "@{u}", "@", "HEAD^!", "HEAD^@", "main~1^-"} {
+			if hash, err := repo.ResolveRevision(rev); !errors.Is(err, ErrRevisionSyntax) {
+				t.Errorf("%s: expected an unsupported revision syntax, got %s, %v", rev, hash, err)
+			}
+		}
+	}
+	t.Run("loose", check)
+	runGit(t, dir, "", "gc", "-q")
+	t.Run("packed", check)
+}
+
+// WalkFunc visits the same commits as git rev-list, newest first
+func TestWalk(t *testing.T) {
+	dir := newTestRepo(t)
+	repo, err := Open(filepath.Join(dir, ".git"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	rev_parse := func(rev string) string {
+		return strings.TrimSpace(runGit(t, dir, "", "rev-parse", rev))
+	}
+
+	for _, walk := range []struct {
+		include []string
+		exclude []string
+	}{
+		{[]string{"main"}, nil},
+		{[]string{"main"}, []string{"topic"}},
+		{[]string{"topic"}, []string{"v1"}},
+		{[]string{"topic", "v1"}, []string{"main~1"}},
+	} {
+		args := []string{"rev-list"}
+		include, exclude := []string{}, []string{}
+		for _, rev := range walk.include {
+			args = append(args, rev)
+			include = append(include, rev_parse(rev+"^{commit}"))
+		}
+		for _, rev := range walk.exclude {
+			args = append(args, "^"+rev)
+			exclude = append(exclude, rev_parse(rev+"^{commit}"))
+		}
+		commits, err := repo.Walk(include, exclude)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes := make([]string, len(commits))
+		for i, commit := range commits {
+			hashes[i] = commit.Hash
+		}
+		if expected := strings.Fields(runGit(t, dir, "", args...)); !slices.Equal(hashes, expected) {
+			t.Errorf("%v: expected %v, got %v", args[1:], expected, hashes)
+		}
+	}
+}
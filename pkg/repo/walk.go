@@ -0,0 +1,112 @@
+package repo
+
+import (
+	"container/heap"
+)
+
+// commitQueue pops the newest commit first, commits with the same date in
+// the order they were pushed, as git does.
+type commitQueue []queuedCommit
+
+type queuedCommit struct {
+	commit *CommitObject
+	order  int
+}
+
+func (q commitQueue) Len() int { return len(q) }
+func (q commitQueue) Less(i, j int) bool {
+	if q[i].commit.Committer.When == q[j].commit.Committer.When {
+		return q[i].order < q[j].order
+	}
+	return q[i].commit.Committer.When > q[j].commit.Committer.When
+}
+func (q commitQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *commitQueue) Push(x any)   { *q = append(*q, x.(queuedCommit)) }
+func (q *commitQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// Walk returns the commits reachable from include but not from exclude,
+// newest committer date first like plain `git log`.
+func (r *Repository) Walk(include, exclude []string) ([]*CommitObject, error) {
+	commits := make([]*CommitObject, 0)
+	err := r.WalkFunc(include, exclude, func(commit *CommitObject) error {
+		commits = append(commits, commit)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return commits, nil
+}
+
+// WalkFunc is Walk calling visit on every commit as soon as it is reached in
+// order, the walk stops at the first error returned by visit.
+func (r *Repository) WalkFunc(include, exclude []string, visit func(*CommitObject) error) error {
+	excluded, err := r.reachable(exclude)
+	if err != nil {
+		return err
+	}
+	return r.WalkExcluding(include, excluded, visit)
+}
+
+// WalkExcluding is WalkFunc stopping at the commits in excluded instead of
+// at everything reachable from a list of commits, so history already known
+// to the caller is not read again.
+func (r *Repository) WalkExcluding(include []string, excluded map[string]bool, visit func(*CommitObject) error) error {
+	seen := make(map[string]bool)
+	queue := &commitQueue{}
+	push := func(hash string) error {
+		if seen[hash] || excluded[hash] {
+			return nil
+		}
+		seen[hash] = true
+		commit, err := r.ReadCommit(hash)
+		if err != nil {
+			return err
+		}
+		heap.Push(queue, queuedCommit{commit, len(seen)})
+		return nil
+	}
+
+	for _, hash := range include {
+		if err := push(hash); err != nil {
+			return err
+		}
+	}
+
+	for queue.Len() > 0 {
+		commit := heap.Pop(queue).(queuedCommit).commit
+		if err := visit(commit); err != nil {
+			return err
+		}
+		for _, parent := range commit.Parents {
+			if err := push(parent); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Repository) reachable(tips []string) (map[string]bool, error) {
+	reached := make(map[string]bool)
+	stack := append([]string{}, tips...)
+	for len(stack) > 0 {
+		hash := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if reached[hash] {
+			continue
+		}
+		reached[hash] = true
+		parents, err := r.commitParents(hash)
+		if err != nil {
+			return nil, err
+		}
+		stack = append(stack, parents...)
+	}
+	return reached, nil
+}
@@ -0,0 +1,90 @@
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Worktree is a checkout of the repository. Branch is the branch it has
+// checked out, empty when detached, and Hash the commit it is at.
+type Worktree struct {
+	Path    string
+	Branch  string
+	Hash    string
+	Current bool
+}
+
+// Worktrees lists the main worktree, unless the repository is bare, and the
+// linked worktrees added with `git worktree add`. Current is set on the one
+// this repository was opened from.
+func (r *Repository) Worktrees() ([]Worktree, error) {
+	worktrees := []Worktree{}
+	if path := r.mainWorktreePath(); path != "" {
+		worktree, err := r.readWorktree(r.CommonDir, path)
+		if err != nil {
+			return nil, err
+		}
+		worktrees = append(worktrees, worktree)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(r.CommonDir, "worktrees"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return worktrees, nil
+		}
+		return nil, err
+	}
+	for _, entry := range entries {
+		git_dir := filepath.Join(r.CommonDir, "worktrees", entry.Name())
+		// gitdir holds the path of the .git file in the worktree
+		content, err := os.ReadFile(filepath.Join(git_dir, "gitdir"))
+		if err != nil {
+			continue
+		}
+		worktree, err := r.readWorktree(git_dir, filepath.Dir(strings.TrimSpace(string(content))))
+		if err != nil {
+			continue
+		}
+		worktrees = append(worktrees, worktree)
+	}
+	return worktrees, nil
+}
+
+// mainWorktreePath is core.worktree when set, as for submodules, otherwise
+// the directory holding .git. A non-bare git directory with another name is
+// its own path, as in `git worktree list`. It is empty for bare repositories,
+// without core.bare a directory not named .git is taken as bare.
+func (r *Repository) mainWorktreePath() string {
+	if path := r.config["core.worktree"]; path != "" {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(r.CommonDir, path)
+		}
+		return filepath.Clean(path)
+	}
+	is_dot_git := filepath.Base(r.CommonDir) == ".git"
+	bare, is_set := r.config["core.bare"]
+	if (is_set && configBool(bare)) || (!is_set && !is_dot_git) {
+		return ""
+	}
+	if is_dot_git {
+		return filepath.Dir(r.CommonDir)
+	}
+	return r.CommonDir
+}
+
+func (r *Repository) readWorktree(git_dir string, path string) (Worktree, error) {
+	branch, hash, err := r.readHead(git_dir)
+	if err != nil {
+		return Worktree{}, err
+	}
+	return Worktree{Path: path, Branch: branch, Hash: hash, Current: git_dir == r.GitDir}, nil
+}
+
+func configBool(value string) bool {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true
+	}
+	return false
+}
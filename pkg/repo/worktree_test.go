@@ -0,0 +1,90 @@
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// gitWorktrees reads `git worktree list` the way the exec reader does,
+// without the bare entry.
+func gitWorktrees(t *testing.T, dir string, git_dir string) []Worktree {
+	t.Helper()
+	worktrees := []Worktree{}
+	output := runGit(t, dir, "", "--git-dir", git_dir, "worktree", "list", "--porcelain")
+	for _, record := range strings.Split(strings.TrimSpace(output), "\n\n") {
+		worktree := Worktree{}
+		bare := false
+		for _, line := range strings.Split(record, "\n") {
+			key, value, _ := strings.Cut(line, " ")
+			switch key {
+			case "worktree":
+				worktree.Path = value
+			case "HEAD":
+				worktree.Hash = value
+			case "branch":
+				worktree.Branch = value
+			case "bare":
+				bare = true
+			}
+		}
+		if !bare {
+			worktrees = append(worktrees, worktree)
+		}
+	}
+	return worktrees
+}
+
+func TestWorktrees(t *testing.T) {
+	dir := newTestRepo(t)
+	linked := filepath.Join(t.TempDir(), "linked")
+	runGit(t, dir, "", "worktree", "add", "-q", linked, "topic")
+	// A non-bare repository whose git directory is not named .git
+	moved := filepath.Join(t.TempDir(), "store")
+	runGit(t, dir, "", "clone", "-q", "--no-checkout", dir, moved)
+	if err := os.Rename(filepath.Join(moved, ".git"), moved+".git-dir"); err != nil {
+		t.Fatal(err)
+	}
+	bare := filepath.Join(t.TempDir(), "bare.git")
+	runGit(t, dir, "", "clone", "-q", "--bare", dir, bare)
+
+	for _, test := range []struct {
+		name     string
+		git_dir  string
+		current  string
+		expected int
+	}{
+		{"main", filepath.Join(dir, ".git"), dir, 2},
+		{"linked", filepath.Join(dir, ".git", "worktrees", "linked"), linked, 2},
+		{"non-bare git dir", moved + ".git-dir", moved + ".git-dir", 1},
+		{"bare", bare, "", 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			repo, err := Open(test.git_dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer repo.Close()
+			worktrees, err := repo.Worktrees()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(worktrees) != test.expected {
+				t.Fatalf("expected %d worktrees, got %+v", test.expected, worktrees)
+			}
+			expected := gitWorktrees(t, dir, test.git_dir)
+			for i, worktree := range worktrees {
+				if worktree.Current != (worktree.Path == test.current) {
+					t.Errorf("unexpected current worktree %+v", worktree)
+				}
+				worktree.Current = false
+				worktrees[i] = worktree
+			}
+			if !slices.Equal(worktrees, expected) {
+				t.Errorf("expected %+v, got %+v", expected, worktrees)
+			}
+		})
+	}
+}
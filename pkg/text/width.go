@@ -0,0 +1,74 @@
+package text
+
+import (
+	"regexp"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// Ellipsis marks where truncated text was cut, it is one column wide.
+const Ellipsis = "…"
+
+var ansi_regex = regexp.MustCompile(`\x1b\[[0-9;]*[a-zA-Z]`)
+
+func StripANSI(s string) string {
+	return ansi_regex.ReplaceAllString(s, "")
+}
+
+// Width returns the number of terminal columns s takes, ignoring color escape
+// codes. Wide characters such as CJK and most emoji take two columns.
+func Width(s string) int {
+	return runewidth.StringWidth(StripANSI(s))
+}
+
+// Truncate keeps the start of s and ends it with an ellipsis when it is wider
+// than width. The result can be one column short when a wide character does
+// not fit, callers that align columns pad with Width of the result.
+func Truncate(s string, width int) string {
+	if runewidth.StringWidth(s) <= width {
+		return s
+	}
+	if width <= 0 {
+		return ""
+	}
+	return runewidth.Truncate(s, width, Ellipsis)
+}
+
+// TruncateLeft keeps the end of s.
+func TruncateLeft(s string, width int) string {
+	if runewidth.StringWidth(s) <= width {
+		return s
+	}
+	if width <= 0 {
+		return ""
+	}
+	return Ellipsis + tail(s, width-1)
+}
+
+// TruncateMiddle keeps both ends of s and puts the ellipsis in between.
+func TruncateMiddle(s string, width int) string {
+	if runewidth.StringWidth(s) <= width {
+		return s
+	}
+	if width <= 0 {
+		return ""
+	}
+	head_width := (width - 1) / 2
+	return runewidth.Truncate(s, head_width, "") + Ellipsis + tail(s, width-1-head_width)
+}
+
+// tail returns the longest end of s that fits in width columns.
+func tail(s string, width int) string {
+	runes := []rune(s)
+	used := 0
+	start := len(runes)
+	for start > 0 {
+		rune_width := runewidth.RuneWidth(runes[start-1])
+		if used+rune_width > width {
+			break
+		}
+		used += rune_width
+		start--
+	}
+	return string(runes[start:])
+}
@@ -0,0 +1,49 @@
+package text
+
+import "testing"
+
+func TestWidth(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+	}{
+		{"abc", 3},
+		{"\x1b[38;5;12mabc\x1b[0m", 3},
+		{"日本語", 6},
+		{"naïve", 5},
+		{"🚀 launch", 9},
+	}
+	for _, test := range tests {
+		if width := Width(test.s); width != test.width {
+			t.Errorf("Width(%q) = %d, expected %d", test.s, width, test.width)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		truncate func(string, int) string
+		s        string
+		width    int
+		expected string
+	}{
+		{Truncate, "hello world", 20, "hello world"},
+		{Truncate, "hello world", 6, "hello…"},
+		{Truncate, "naïve café", 5, "naïv…"},
+		{Truncate, "日本語のテキスト", 7, "日本語…"},
+		{Truncate, "日本語のテキスト", 8, "日本語…"},
+		{TruncateLeft, "hello world", 6, "…world"},
+		{TruncateLeft, "日本語のテキスト", 6, "…スト"},
+		{TruncateMiddle, "hello world", 7, "hel…rld"},
+		{Truncate, "abc", 0, ""},
+	}
+	for _, test := range tests {
+		truncated := test.truncate(test.s, test.width)
+		if truncated != test.expected {
+			t.Errorf("truncating %q to %d: expected %q, got %q", test.s, test.width, test.expected, truncated)
+		}
+		if Width(truncated) > test.width {
+			t.Errorf("truncating %q to %d gave %q, which is %d columns wide", test.s, test.width, truncated, Width(truncated))
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package theme
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	color "git-graph/pkg/color"
+
+	"github.com/BurntSushi/toml"
+)
+
+type Highlight struct {
+	Foreground color.RGB `toml:"foreground"`
+	Background color.RGB `toml:"background"`
+	Bold       bool      `toml:"bold"`
+}
+
+// Theme holds every color git-graph draws with. Unset optional colors fall
+// back to the lane color for glyphs and to the terminal default for text.
+// Ref kinds without their own color use Refs.
+type Theme struct {
+	Name      string      `toml:"name"`
+	Extends   string      `toml:"extends"`
+	Lanes     []color.RGB `toml:"lanes"`
+	Commit    *color.RGB  `toml:"commit"`
+	Merge     *color.RGB  `toml:"merge"`
+	Hash      *color.RGB  `toml:"hash"`
+	Message   *color.RGB  `toml:"message"`
+	Date      *color.RGB  `toml:"date"`
+	Author    *color.RGB  `toml:"author"`
+	Refs      *color.RGB  `toml:"refs"`
+	Head      *color.RGB  `toml:"head"`
+	Branch    *color.RGB  `toml:"branch"`
+	Remote    *color.RGB  `toml:"remote"`
+	Tag       *color.RGB  `toml:"tag"`
+	Highlight Highlight   `toml:"highlight"`
+}
+
+func rgb(r, g, b uint8) *color.RGB {
+	return &color.RGB{R: r, G: g, B: b}
+}
+
+var Dark = Theme{
+	Name: "dark",
+	Lanes: []color.RGB{
+		{R: 255, G: 182, B: 193},
+		{R: 173, G: 216, B: 230},
+		{R: 255, G: 223, B: 170},
+		{R: 199, G: 214, B: 189},
+		{R: 188, G: 143, B: 143},
+		{R: 221, G: 160, B: 221},
+	},
+	Hash:   rgb(229, 192, 123),
+	Date:   rgb(150, 150, 150),
+	Author: rgb(97, 175, 239),
+	Refs:   rgb(86, 182, 194),
+	Head:   rgb(224, 108, 117),
+	Branch: rgb(152, 195, 121),
+	Remote: rgb(198, 120, 221),
+	Tag:    rgb(229, 192, 123),
+	Highlight: Highlight{
+		Foreground: color.RGB{R: 255, G: 255, B: 175},
+		Background: color.RGB{R: 95, G: 0, B: 255},
+		Bold:       true,
+	},
+}
+
+var Light = Theme{
+	Name: "light",
+	Lanes: []color.RGB{
+		{R: 200, G: 40, B: 80},
+		{R: 30, G: 110, B: 200},
+		{R: 190, G: 120, B: 0},
+		{R: 40, G: 140, B: 60},
+		{R: 140, G: 70, B: 70},
+		{R: 140, G: 60, B: 160},
+	},
+	Hash:   rgb(150, 100, 0),
+	Date:   rgb(110, 110, 110),
+	Author: rgb(30, 90, 170),
+	Refs:   rgb(0, 120, 140),
+	Head:   rgb(190, 40, 40),
+	Branch: rgb(40, 130, 40),
+	Remote: rgb(130, 50, 160),
+	Tag:    rgb(160, 110, 0),
+	Highlight: Highlight{
+		Foreground: color.RGB{R: 255, G: 255, B: 255},
+		Background: color.RGB{R: 0, G: 95, B: 215},
+		Bold:       true,
+	},
+}
+
+var BUILTIN_THEMES = map[string]Theme{
+	"dark":  Dark,
+	"light": Light,
+}
+
+const max_extends_depth = 5
+
+// Load returns a built-in theme, a theme file given by path, or a theme file
+// named <name>.toml in the themes directory of the user config.
+func Load(name string) (Theme, error) {
+	return load(name, 0)
+}
+
+func load(name string, depth int) (Theme, error) {
+	if theme, exists := BUILTIN_THEMES[name]; exists {
+		return theme, nil
+	}
+	if depth > max_extends_depth {
+		return Theme{}, fmt.Errorf("theme %s: too many nested extends", name)
+	}
+
+	path := name
+	if _, err := os.Stat(path); err != nil {
+		path = filepath.Join(ThemesDir(), name+".toml")
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Theme{}, fmt.Errorf("unknown theme %q, expected dark, light or a theme file", name)
+		}
+		return Theme{}, err
+	}
+	return parse(path, content, depth)
+}
+
+func parse(path string, content []byte, depth int) (Theme, error) {
+	var header struct {
+		Extends string `toml:"extends"`
+	}
+	if _, err := toml.Decode(string(content), &header); err != nil {
+		return Theme{}, fmt.Errorf("theme %s: %w", path, err)
+	}
+
+	base := Dark
+	if header.Extends != "" {
+		var err error
+		if base, err = load(header.Extends, depth+1); err != nil {
+			return Theme{}, err
+		}
+	}
+
+	// Decoding on top of the base theme keeps every color the file leaves out
+	theme := base.clone()
+	theme.Lanes = nil
+	if _, err := toml.Decode(string(content), &theme); err != nil {
+		return Theme{}, fmt.Errorf("theme %s: %w", path, err)
+	}
+	if len(theme.Lanes) == 0 {
+		theme.Lanes = base.Lanes
+	}
+	if theme.Name == "" || theme.Name == base.Name {
+		theme.Name = filepath.Base(path)
+	}
+	return theme, nil
+}
+
+func ThemesDir() string {
+	config_dir := os.Getenv("XDG_CONFIG_HOME")
+	if config_dir == "" {
+		config_dir = filepath.Join(os.Getenv("HOME"), ".config")
+	}
+	return filepath.Join(config_dir, "git-graph", "themes")
+}
+
+// clone copies the optional colors, decoding into a shared pointer would
+// modify the built-in themes.
+func (t Theme) clone() Theme {
+	copy_color := func(c *color.RGB) *color.RGB {
+		if c == nil {
+			return nil
+		}
+		copied := *c
+		return &copied
+	}
+	t.Lanes = append([]color.RGB{}, t.Lanes...)
+	t.Commit = copy_color(t.Commit)
+	t.Merge = copy_color(t.Merge)
+	t.Hash = copy_color(t.Hash)
+	t.Message = copy_color(t.Message)
+	t.Date = copy_color(t.Date)
+	t.Author = copy_color(t.Author)
+	t.Refs = copy_color(t.Refs)
+	t.Head = copy_color(t.Head)
+	t.Branch = copy_color(t.Branch)
+	t.Remote = copy_color(t.Remote)
+	t.Tag = copy_color(t.Tag)
+	return t
+}
+
+// Lane returns the color of lane x, cycling through the palette.
+func (t Theme) Lane(x int) color.RGB {
+	return t.Lanes[x%len(t.Lanes)]
+}
@@ -0,0 +1,51 @@
+package theme
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	color "git-graph/pkg/color"
+)
+
+func TestLoadThemeFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mine.toml")
+	content := `
+extends = "light"
+hash = "#ff0000"
+lanes = ["#00ff00", "#0000ff"]
+
+[highlight]
+bold = false
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *loaded.Hash != (color.RGB{R: 255}) {
+		t.Errorf("expected hash color from the file, got %v", *loaded.Hash)
+	}
+	if *loaded.Date != *Light.Date {
+		t.Errorf("expected date color from the light theme, got %v", *loaded.Date)
+	}
+	if len(loaded.Lanes) != 2 || loaded.Lane(3) != (color.RGB{B: 255}) {
+		t.Errorf("unexpected lanes %v", loaded.Lanes)
+	}
+	if loaded.Highlight.Bold || loaded.Highlight.Background != Light.Highlight.Background {
+		t.Errorf("unexpected highlight %v", loaded.Highlight)
+	}
+	if *Light.Hash == *loaded.Hash {
+		t.Errorf("loading a theme modified the built-in light theme")
+	}
+}
+
+func TestLoadUnknownTheme(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if _, err := Load("missing"); err == nil {
+		t.Error("expected an error for an unknown theme")
+	}
+}
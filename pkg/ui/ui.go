@@ -1,27 +1,45 @@
 package ui
 
 import (
+	"fmt"
+	color "git-graph/pkg/color"
 	"git-graph/pkg/commit"
-	"log"
-	"regexp"
+	"git-graph/pkg/graph"
+	text "git-graph/pkg/text"
+	theme "git-graph/pkg/theme"
+	"slices"
 	"strings"
 
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	libgloss "github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
 )
 
-var highlight_style libgloss.Style = libgloss.NewStyle().Foreground(libgloss.Color("229")).Background(libgloss.Color("57")).Bold(true)
+var highlight_style libgloss.Style = highlightStyle(theme.Dark)
+var show_details = true
+var date_format commit.DateFormat
+
+// Number of commits laid out before the view is shown, later windows double it
+const first_window = 200
 
 type model struct {
-	lines         []map[string]string
-	current_hash  string
-	jump          int
-	cursor        int
-	graph_width   int
-	details_width int
-	height        int
-	details_view  viewport.Model
+	lazy           *graph.LazyGraph
+	expandable     Expandable
+	lines          []graph.Line
+	window         int
+	complete       bool
+	loading        bool
+	err            error
+	current_hash   string
+	current_commit *commit.Commit
+	jump           int
+	cursor         int
+	graph_width    int
+	width          int
+	details_width  int
+	height         int
+	details_view   viewport.Model
 }
 
 func (m model) Init() tea.Cmd {
@@ -31,10 +49,19 @@ func (m model) Init() tea.Cmd {
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
+		m.width = msg.Width
 		m.details_width = msg.Width - m.graph_width - 10
 		m.height = msg.Height - 1
 		m.details_view = viewport.New(m.details_width, m.height)
 
+	case windowMsg:
+		m.loading = false
+		if msg.err != nil {
+			m.err = msg.err
+			return m, tea.Quit
+		}
+		m.setLines(msg.lines, msg.complete)
+
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "q", "ctrl+c":
@@ -45,19 +72,86 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			} else {
 				m.cursor = (len(m.lines) - 1) / m.jump
 			}
-			m.current_hash = m.lines[m.jump*m.cursor]["hash"]
+			m.selectLine(m.jump * m.cursor)
+			return m, m.loadMore()
 		case "up", "k":
 			if m.jump*(m.cursor-1) >= 0 {
 				m.cursor--
 			} else {
 				m.cursor = 0
 			}
-			m.current_hash = m.lines[m.jump*m.cursor]["hash"]
+			m.selectLine(m.jump * m.cursor)
+		case "enter", " ":
+			m.toggleNode()
 		}
 	}
 	return m, nil
 }
 
+type windowMsg struct {
+	lines    []graph.Line
+	complete bool
+	err      error
+}
+
+// loadMore lays out the next window in the background once the cursor gets
+// within two screens of the last laid out line.
+func (m *model) loadMore() tea.Cmd {
+	if m.lazy == nil || m.complete || m.loading || m.jump*m.cursor+2*m.height < len(m.lines) {
+		return nil
+	}
+	m.loading = true
+	m.window *= 2
+	lazy, window := m.lazy, m.window
+	return func() tea.Msg {
+		lines, complete, err := lazy.Window(window)
+		return windowMsg{lines, complete, err}
+	}
+}
+
+// setLines replaces the laid out lines, commits can move between windows so
+// the cursor follows the selected commit.
+func (m *model) setLines(lines []graph.Line, complete bool) {
+	m.lines = lines
+	m.complete = complete
+	if len(lines) > 0 {
+		m.graph_width = text.Width(lines[0].String())
+	}
+	if m.width > 0 {
+		m.details_width = m.width - m.graph_width - 10
+		m.details_view = viewport.New(m.details_width, m.height)
+	}
+	for index, line := range lines {
+		if line.Hash != "" && line.Hash == m.current_hash {
+			m.cursor = index / m.jump
+			return
+		}
+	}
+}
+
+// toggleNode expands or collapses the node of the selected commit, the node
+// stays selected.
+func (m *model) toggleNode() {
+	if m.expandable == nil || m.current_hash == "" {
+		return
+	}
+	node_hash := m.expandable.Toggle(m.current_hash)
+	if node_hash == "" {
+		return
+	}
+	m.current_hash = node_hash
+	m.setLines(m.expandable.Lines(), true)
+	m.selectLine(m.jump * m.cursor)
+}
+
+func (m *model) selectLine(index int) {
+	if index >= len(m.lines) {
+		return
+	}
+	m.current_hash = m.lines[index].Hash
+	m.current_commit = m.lines[index].Commit
+}
+
 func updateGraphView(m *model) string {
 	start_index := m.cursor * m.jump
 	if start_index+m.height > len(m.lines) {
@@ -71,17 +165,19 @@ func updateGraphView(m *model) string {
 	var graph strings.Builder
 	for i := range view_height {
 		line := m.lines[start_index+i]
-		if line["hash"] == m.current_hash {
-			highlighted := highlight_style.Render(line["hash"])
-			graph.WriteString(line["graph"] + " " + highlighted + " " + line["body"] + "\n")
+		if line.Hash != "" && line.Hash == m.current_hash {
+			graph.WriteString(line.Graph + highlight_style.Render(line.Plain) + "\n")
 		} else {
-			graph.WriteString(line["graph"] + " " + line["hash"] + " " + line["body"] + "\n")
+			graph.WriteString(line.String() + "\n")
 		}
 	}
 	return graph.String()
 }
 
 func (m model) View() string {
+	if !show_details {
+		return updateGraphView(&m)
+	}
 	graph_style := libgloss.NewStyle().
 		Width(m.graph_width).
 		BorderRight(true).
@@ -89,7 +185,7 @@ func (m model) View() string {
 		BorderForeground(libgloss.Color("242"))
 
 	details_style := libgloss.NewStyle().Width(m.details_width).MarginLeft(1)
-	m.details_view.SetContent(getDetails(m.current_hash))
+	m.details_view.SetContent(getDetails(m.current_commit))
 
 	return libgloss.JoinHorizontal(
 		libgloss.Top,
@@ -98,31 +194,133 @@ func (m model) View() string {
 	)
 }
 
-func getDetails(hash string) string {
-	return commit.GetCommitStats(hash)
+// formatDate uses the layout of git show unless a date format was set.
+func formatDate(signature commit.Signature) string {
+	if date_format == (commit.DateFormat{}) {
+		return signature.Time().Format("Mon Jan 2 15:04:05 2006 -0700")
+	}
+	return date_format.Format(signature)
+}
+
+func getDetails(c *commit.Commit) string {
+	if c == nil {
+		return ""
+	}
+	if c.Summary {
+		// The body lists the folded commits, newest first
+		return c.Message + ", enter shows them\n\n    " + strings.ReplaceAll(c.Body, "\n", "\n    ") + "\n"
+	}
+	var details strings.Builder
+	fmt.Fprintf(&details, "commit %s\n", c.Hash)
+	// Same layout as git show --format=fuller
+	for _, signature := range []struct {
+		title string
+		commit.Signature
+	}{{"Author", c.Author}, {"Commit", c.Committer}} {
+		if signature.Name == "" {
+			continue
+		}
+		fmt.Fprintf(&details, "%-11s %s <%s>\n", signature.title+":", signature.Name, signature.Email)
+		fmt.Fprintf(&details, "%-11s %s\n", signature.title+"Date:", formatDate(signature.Signature))
+	}
+	details.WriteString("\n    " + c.Message + "\n")
+	if c.Collapsed > 0 {
+		fmt.Fprintf(&details, "\n    %d commits merged, enter shows them\n", c.Collapsed)
+	}
+	if c.Body != "" {
+		details.WriteString("\n    " + strings.ReplaceAll(c.Body, "\n", "\n    ") + "\n")
+	}
+	details.WriteString("\n" + commit.GetCommitStats(c.Hash))
+	return details.String()
+}
+
+func highlightStyle(t theme.Theme) libgloss.Style {
+	return libgloss.NewStyle().
+		Foreground(libgloss.Color(t.Highlight.Foreground.Hex())).
+		Background(libgloss.Color(t.Highlight.Background.Hex())).
+		Bold(t.Highlight.Bold)
+}
+
+func SetTheme(t theme.Theme) {
+	highlight_style = highlightStyle(t)
+}
+
+// SetShowDetails toggles the commit details pane next to the graph.
+func SetShowDetails(enabled bool) {
+	show_details = enabled
 }
 
-func strLen(str string) int {
-	ansiRegex := regexp.MustCompile(`\x1b\[[0-9;]*[a-zA-Z]`)
-	s := ansiRegex.ReplaceAllString(str, "")
-	return len(s)
+func SetDateFormat(format commit.DateFormat) {
+	date_format = format
 }
 
-func initModel(lines []map[string]string, jump int) model {
-	width := strLen(lines[0]["graph"]) + len(lines[0]["hash"]) + len(lines[0]["body"]) + 1
-	return model{
-		lines:        lines,
-		jump:         jump,
-		current_hash: lines[0]["hash"],
-		cursor:       0,
-		graph_width:  width,
+func SetColorProfile(profile color.Profile) {
+	switch profile {
+	case color.NoColor:
+		libgloss.SetColorProfile(termenv.Ascii)
+	case color.ANSI16:
+		libgloss.SetColorProfile(termenv.ANSI)
+	case color.ANSI256:
+		libgloss.SetColorProfile(termenv.ANSI256)
+	case color.TrueColor:
+		libgloss.SetColorProfile(termenv.TrueColor)
 	}
 }
 
-func Run(lines []map[string]string, jump int) {
+// initModel selects the first line, an empty graph has nothing selected.
+func initModel(lines []graph.Line, jump int) model {
+	m := model{
+		lines:  lines,
+		jump:   jump,
+		cursor: 0,
+	}
+	if len(lines) > 0 {
+		m.graph_width = text.Width(lines[0].String())
+		m.current_hash = lines[0].Hash
+		m.current_commit = lines[0].Commit
+	}
+	return m
+}
+
+// Run shows the graph while lazy is still reading commits, starting as soon
+// as the first window is laid out. It returns commit.ErrEmptyRange without
+// starting the view when there are no commits.
+func Run(lazy *graph.LazyGraph, jump int) error {
+	lines, complete, err := lazy.Window(first_window)
+	if err != nil {
+		return err
+	}
+	has_commits := slices.ContainsFunc(lines, func(line graph.Line) bool { return line.Hash != "" })
+	if complete && !has_commits {
+		return commit.ErrEmptyRange
+	}
 	m := initModel(lines, jump)
-	p := tea.NewProgram(m)
-	if _, err := p.Run(); err != nil {
-		log.Fatal(err)
+	m.lazy = lazy
+	m.window = first_window
+	m.complete = complete
+	return run(m)
+}
+
+// Expandable is a graph with nodes standing for several commits, such as
+// graph.FirstParentView and graph.ChainView. Toggle expands or collapses the
+// node of a commit and returns the hash of the node, empty when it has none.
+type Expandable interface {
+	Toggle(hash string) string
+	Lines() []graph.Line
+}
+
+// RunExpandable shows view, enter expands and collapses the selected node.
+func RunExpandable(view Expandable, jump int) error {
+	m := initModel(view.Lines(), jump)
+	m.expandable = view
+	m.complete = true
+	return run(m)
+}
+
+func run(m model) error {
+	final_model, err := tea.NewProgram(m).Run()
+	if err != nil {
+		return err
 	}
+	return final_model.(model).err
 }
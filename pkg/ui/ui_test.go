@@ -0,0 +1,92 @@
+package ui
+
+import (
+	color "git-graph/pkg/color"
+	"git-graph/pkg/commit"
+	"git-graph/pkg/graph"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The details use the layout of git show --format=fuller
+func TestDetails(t *testing.T) {
+	c := &commit.Commit{
+		Hash:      strings.Repeat("0", 40),
+		Message:   "Subject",
+		Body:      "line one\nline two",
+		Timestamp: 1700000000,
+		Author:    commit.Signature{Name: "A U Thor", Email: "a u@example.com", Timestamp: 1700000000, Offset: "-0230"},
+		Committer: commit.Signature{Name: "C O Mitter", Email: "committer@example.com", Timestamp: 1700000060, Offset: "+0100"},
+	}
+	expected := "commit 0000000000000000000000000000000000000000\n" +
+		"Author:     A U Thor <a u@example.com>\n" +
+		"AuthorDate: Tue Nov 14 19:43:20 2023 -0230\n" +
+		"Commit:     C O Mitter <committer@example.com>\n" +
+		"CommitDate: Tue Nov 14 23:14:20 2023 +0100\n" +
+		"\n    Subject\n" +
+		"\n    line one\n    line two\n\n"
+	if details := getDetails(c); details != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, details)
+	}
+
+	// Like git, the committer is left out when the commit has none
+	c.Committer = commit.Signature{}
+	c.Body = ""
+	expected = "commit 0000000000000000000000000000000000000000\n" +
+		"Author:     A U Thor <a u@example.com>\n" +
+		"AuthorDate: Tue Nov 14 19:43:20 2023 -0230\n" +
+		"\n    Subject\n\n"
+	if details := getDetails(c); details != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, details)
+	}
+
+	saved := date_format
+	defer func() { date_format = saved }()
+	format, err := commit.ParseDateFormat("iso", "utc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetDateFormat(format)
+	if details := getDetails(c); !strings.Contains(details, "AuthorDate: 2023-11-14 22:13:20 +0000\n") {
+		t.Errorf("expected the author date in UTC, got\n%s", details)
+	}
+}
+
+// Rows can move when the next window is laid out, the selected commit stays
+// selected at the top of the view
+func TestWindowKeepsSelection(t *testing.T) {
+	options := graph.DefaultRenderOptions()
+	options.Color = color.NoColor
+	lazy := graph.NewLazyGraph(options)
+	lazy.Load(commit.JSONSource{Path: filepath.Join("..", "graph", "testdata", "fixtures", "many-merges-readable.json")})
+
+	lines, _, err := lazy.Window(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	window, complete, err := lazy.Window(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved := false
+	for row := range 8 {
+		m := initModel(lines, options.YSpacing)
+		m.height = 4
+		m.cursor = row
+		m.selectLine(m.jump * m.cursor)
+		selected := m.current_hash
+
+		m.setLines(window, complete)
+		if m.current_hash != selected || m.lines[m.jump*m.cursor].Hash != selected {
+			t.Errorf("row %d: expected %s still selected, the cursor is on %s", row, selected[:8], m.lines[m.jump*m.cursor].Hash)
+		}
+		if view := updateGraphView(&m); !strings.HasPrefix(view, m.lines[m.jump*m.cursor].String()) {
+			t.Errorf("row %d: expected the selected commit at the top of the view", row)
+		}
+		moved = moved || m.cursor != row
+	}
+	if !moved {
+		t.Error("expected commits to move between the windows of this history")
+	}
+}
@@ -10,26 +10,30 @@ import (
 	"strings"
 )
 
+// CommitToStore is the JSONSource format with the computed position.
 type CommitToStore struct {
-	Hash    string   `json:"hash"`
-	X_pos   int      `json:"x_pos"`
-	Y_pos   int      `json:"y_pos"`
-	Parents []string `json:"parents"`
-	Message string   `json:"message"`
+	commit.JSONCommit
+	X_pos int `json:"x_pos"`
+	Y_pos int `json:"y_pos"`
 }
 
 func SaveCommitPositionsToFile(commits map[string]*commit.Commit, file_path string) error {
 	positions := make([]CommitToStore, 0)
-	for _, commit := range commits {
+	for _, c := range commits {
 		positions = append(positions, CommitToStore{
-			Hash:    commit.Hash,
-			X_pos:   commit.X_pos,
-			Y_pos:   commit.Y_pos,
-			Parents: commit.Parents,
-			Message: commit.Message,
+			JSONCommit: commit.NewJSONCommit(*c),
+			X_pos:      c.X_pos,
+			Y_pos:      c.Y_pos,
 		})
 	}
 
+	sort.Slice(positions, func(i, j int) bool {
+		if positions[i].Y_pos == positions[j].Y_pos {
+			return positions[i].X_pos < positions[j].X_pos
+		}
+		return positions[i].Y_pos < positions[j].Y_pos
+	})
+
 	jsonBytes, err := json.MarshalIndent(positions, "", "    ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal to JSON: %v", err)
@@ -40,8 +44,14 @@ func SaveCommitPositionsToFile(commits map[string]*commit.Commit, file_path stri
 	return err
 }
 
+var save_commits = os.Getenv("GRAPH_SAVE_JSON") == "true"
+
+func SetSaveCommits(enabled bool) {
+	save_commits = enabled
+}
+
 func SaveCommits() bool {
-	return os.Getenv("GRAPH_SAVE_JSON") == "true"
+	return save_commits
 }
 
 func FormatGraphStructure(commits_map map[string]*commit.Commit, children_map map[string][]string) string {
@@ -53,6 +63,9 @@ func FormatGraphStructure(commits_map map[string]*commit.Commit, children_map ma
 	}
 
 	sort.Slice(sorted_commits, func(i, j int) bool {
+		if sorted_commits[i].Y_pos == sorted_commits[j].Y_pos {
+			return sorted_commits[i].X_pos < sorted_commits[j].X_pos
+		}
 		return sorted_commits[i].Y_pos < sorted_commits[j].Y_pos
 	})
 	result := ""
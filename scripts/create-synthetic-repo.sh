@@ -15,12 +15,20 @@ configure_repo() {
 }
 
 
+# Contents and both dates only depend on the arguments, so recording the
+# fixtures again gives the same hashes
 commit_random_file() {
 	local file_name=$1
 	local timestamp=$2
-    content=$(tr -dc A-Za-z0-9 </dev/urandom | head -c 100)
+    content=$(echo "$file_name $timestamp" | sha256sum | head -c 64)
     echo "$content" > "$DIR_NAME/$file_name"
-    git add -f "$DIR_NAME/$file_name" && git commit -m "$file_name" --date="$timestamp +0000"
+    git add -f "$DIR_NAME/$file_name" && GIT_COMMITTER_DATE="$timestamp +0000" git commit -m "$file_name" --date="$timestamp +0000"
+}
+
+# Sets both dates of a merge, git merge uses the current time
+amend_date() {
+	local timestamp=$1
+	GIT_COMMITTER_DATE="$timestamp +0000" git commit --amend --no-edit --date="$timestamp +0000"
 }
 
 
@@ -57,7 +65,7 @@ configure_new_repo_with_confirmation() {
 
 octopus_merge_from_inside() {
 	local start_date=$1
-	timestamp=$(date -d "$start_date" +%s)
+	timestamp=$(date -u -d "$start_date" +%s)
 	commit_random_file "master-c1" "$timestamp"
 	timestamp=$(($timestamp + 60))
 
@@ -79,13 +87,13 @@ octopus_merge_from_inside() {
 	$(git rev-parse 'f1~2') \
 	$(git rev-parse 'f2~3') \
 	$(git rev-parse 'f3~4')
-	git commit --amend --no-edit --date="$timestamp +0000"
+	amend_date "$timestamp"
 }
 
 canonical_octopus_merge() {
 	local start_date=$1
 	local branch_number=$2
-	timestamp=$(date -d "$start_date" +%s)
+	timestamp=$(date -u -d "$start_date" +%s)
 	commit_random_file "master-c1" "$timestamp"
 	timestamp=$(($timestamp + 60))
 
@@ -104,14 +112,14 @@ canonical_octopus_merge() {
 	timestamp=$(sequence_of_commits "$timestamp" 1)
 
 	git checkout master
-	git commit --amend --no-edit --date="$timestamp +0000"
+	amend_date "$timestamp"
 }
 
 
 _many_merges() {
 	local start_date=$1
 
-	timestamp=$(date -d "$start_date" +%s)
+	timestamp=$(date -u -d "$start_date" +%s)
 	commit_random_file "c1" "$timestamp"
 	timestamp=$(($timestamp + 60))
 
@@ -128,12 +136,12 @@ _many_merges() {
 
 	git checkout b1
 	git merge --no-ff -m "M b1<-b2" -X theirs b2
-	git commit --amend --no-edit --date="$timestamp +0000"
+	amend_date "$timestamp"
 	timestamp=$(($timestamp + 60))
 
 	git checkout b3
 	git merge --no-ff -m "M b2->b3" -X theirs b2
-	git commit --amend --no-edit --date="$timestamp +0000"
+	amend_date "$timestamp"
 	timestamp=$(($timestamp + 60))
 
 	git checkout master
@@ -142,7 +150,7 @@ _many_merges() {
 
 	git checkout b2
 	git merge --no-ff -m "b1->b2<-b3" -X theirs b1 b3
-	git commit --amend --no-edit --date="$timestamp +0000"
+	amend_date "$timestamp"
 	timestamp=$(($timestamp + 60))
 
 	git checkout b4
@@ -151,7 +159,7 @@ _many_merges() {
 
 	git checkout master
 	git merge --no-ff -m "M<-b2<-b4" -X theirs b2 b4
-	git commit --amend --no-edit --date="$timestamp +0000"
+	amend_date "$timestamp"
 	timestamp=$(($timestamp + 60))
 
 	git checkout b4
@@ -165,7 +173,7 @@ _many_merges() {
 	git merge --no-ff -m "m->b2<-b4" -X theirs \
 	$(git rev-parse 'master~1') \
 	$(git rev-parse 'b4~1')
-	git commit --amend --no-edit --date="$timestamp +0000"
+	amend_date "$timestamp"
 	timestamp=$(($timestamp + 60))
 
 	git checkout master